@@ -0,0 +1,56 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ArgValues is a flag.Value collecting repeatable `--arg KEY=VALUE` flags.
+type ArgValues map[string]string
+
+func (a *ArgValues) String() string {
+	if a == nil || *a == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*a))
+	for k, v := range *a {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (a *ArgValues) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return fmt.Errorf("bad arg `%s`, format should be KEY=VALUE", value)
+	}
+	if *a == nil {
+		*a = make(ArgValues)
+	}
+	(*a)[strings.TrimSpace(kv[0])] = kv[1]
+	return nil
+}
+
+// ResolveArgs returns the effective args of a package.
+// defaults are the args declared in the package's pkg.yaml,
+// and the value of a declared arg can be overridden by overrides (later overrides have higher priority).
+// Args not declared in defaults are ignored.
+func ResolveArgs(defaults map[string]string, overrides ...map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return nil
+	}
+	args := make(map[string]string, len(defaults))
+	for k, v := range defaults {
+		args[k] = v
+	}
+	for _, override := range overrides {
+		for k, v := range override {
+			if _, ok := args[k]; ok {
+				args[k] = v
+			}
+		}
+	}
+	return args
+}
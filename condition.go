@@ -0,0 +1,73 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// Platform is the target platform where packages are built.
+type Platform struct {
+	OS   string `yaml:"os,omitempty"`   // the same values as runtime.GOOS, e.g. linux, darwin, windows.
+	Arch string `yaml:"arch,omitempty"` // the same values as runtime.GOARCH, e.g. amd64, arm64.
+}
+
+// CurrentPlatform returns the platform where pkg is running.
+func CurrentPlatform() Platform {
+	return Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+}
+
+// YamlCondition is the `when` condition of a dependency package or a feature.
+// All of the specified os, arch and expression must be matched.
+// e.g. `when: {os: [linux], arch: [amd64, arm64]}`
+// or `when: {expr: 'and (eq .OS "linux") (ne .ARCH "arm64")'}`.
+type YamlCondition struct {
+	OS   []string `yaml:"os"`   // match if the target os is in the list.
+	Arch []string `yaml:"arch"` // match if the target arch is in the list.
+	Expr string   `yaml:"expr"` // template pipeline, match if it is evaluated to be true. Variables: .OS, .ARCH
+}
+
+// Match checks whether the condition is matched on platform p.
+// A nil condition always matches.
+func (c *YamlCondition) Match(p Platform) (bool, error) {
+	if c == nil {
+		return true, nil
+	}
+	if len(c.OS) != 0 && !containsString(c.OS, p.OS) {
+		return false, nil
+	}
+	if len(c.Arch) != 0 && !containsString(c.Arch, p.Arch) {
+		return false, nil
+	}
+	if c.Expr == "" {
+		return true, nil
+	}
+
+	// the expression is a single pipeline, it can not contain actions.
+	if strings.Contains(c.Expr, "{{") || strings.Contains(c.Expr, "}}") {
+		return false, fmt.Errorf("bad condition expression `%s`: delimiters `{{` and `}}` are not allowed", c.Expr)
+	}
+	if _, err := template.New("when").Parse("{{" + c.Expr + "}}"); err != nil {
+		return false, fmt.Errorf("bad condition expression `%s`: %w", c.Expr, err)
+	}
+	tmpl, err := template.New("when").Option("missingkey=error").Parse("{{if " + c.Expr + "}}true{{end}}")
+	if err != nil {
+		return false, fmt.Errorf("bad condition expression `%s`: %w", c.Expr, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]string{"OS": p.OS, "ARCH": p.Arch}); err != nil {
+		return false, fmt.Errorf("bad condition expression `%s`: %w", c.Expr, err)
+	}
+	return buf.String() == "true", nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package pkg
+
+import "testing"
+
+func TestYamlCondition_Match(t *testing.T) {
+	linux := Platform{OS: "linux", Arch: "amd64"}
+	tests := []struct {
+		name  string
+		cond  *YamlCondition
+		match bool
+		err   bool
+	}{
+		{"nil", nil, true, false},
+		{"os", &YamlCondition{OS: []string{"linux", "darwin"}}, true, false},
+		{"os not match", &YamlCondition{OS: []string{"windows"}}, false, false},
+		{"arch not match", &YamlCondition{OS: []string{"linux"}, Arch: []string{"arm64"}}, false, false},
+		{"expr", &YamlCondition{Expr: `and (eq .OS "linux") (ne .ARCH "arm64")`}, true, false},
+		{"expr not match", &YamlCondition{Expr: `eq .ARCH "arm64"`}, false, false},
+		{"expr undefined variable", &YamlCondition{Expr: `eq .CPU "arm64"`}, false, true},
+		{"expr syntax error", &YamlCondition{Expr: `eq .OS (`}, false, true},
+		{"expr with actions", &YamlCondition{Expr: `false}}{{end}}{{if true`}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := tt.cond.Match(linux)
+			if (err != nil) != tt.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if match != tt.match {
+				t.Errorf("expect match %v, but got %v", tt.match, match)
+			}
+		})
+	}
+}
@@ -10,8 +10,10 @@ import (
 const ConfigFileName = "pkg.config.yaml"
 
 type PkgConfig struct {
-	Auth       map[string]Auth   `yaml:"auth"`
-	GitReplace map[string]string `yaml:"git-replace"`
+	Auth       map[string]Auth    `yaml:"auth"`
+	GitReplace map[string]string  `yaml:"git-replace"`
+	Args       map[string]string  `yaml:"args"`     // override values of args declared in pkg.yaml files.
+	Profiles   map[string]Profile `yaml:"profiles"` // toolchain profiles for building packages.
 }
 
 func ParseConfig(projectHome string) (*PkgConfig, error) {
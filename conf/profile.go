@@ -0,0 +1,75 @@
+package conf
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Profile is a named toolchain configuration for building packages, which is selected by `pkg install -profile`.
+// e.g.
+//
+//	profiles:
+//	  aarch64:
+//	    cc: aarch64-linux-gnu-gcc
+//	    cxx: aarch64-linux-gnu-g++
+//	    toolchain_file: cmake/aarch64.cmake
+//	    cmake_args: ["-DENABLE_SIMD=OFF"]
+//	    env: {PKG_CONFIG_PATH: /opt/aarch64/lib/pkgconfig}
+//	    build_type: Release
+type Profile struct {
+	CC            string            `yaml:"cc"`
+	CXX           string            `yaml:"cxx"`
+	FC            string            `yaml:"fc"`
+	ToolchainFile string            `yaml:"toolchain_file"` // CMAKE_TOOLCHAIN_FILE, relative to the project home
+	CMakeArgs     []string          `yaml:"cmake_args"`     // extra arguments of cmake configuration
+	Env           map[string]string `yaml:"env"`            // environment variables of building commands
+	BuildType     string            `yaml:"build_type"`     // default cmake build type of the profile
+}
+
+// FindProfile returns the profile by name, relative toolchain file is resolved with the project home.
+func (c *PkgConfig) FindProfile(name, projectHome string) (Profile, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for k := range c.Profiles {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return Profile{}, fmt.Errorf("profile `%s` is not found in %s, available profiles: [%s]", name, ConfigFileName, strings.Join(names, ", "))
+	}
+	if profile.ToolchainFile != "" && !filepath.IsAbs(profile.ToolchainFile) {
+		profile.ToolchainFile = filepath.Join(projectHome, profile.ToolchainFile)
+	}
+	return profile, nil
+}
+
+// Environ returns the environment variables set by the profile in "KEY=VALUE" format, sorted by key.
+func (p *Profile) Environ() []string {
+	envs := make([]string, 0, len(p.Env)+3)
+	for _, kv := range [][2]string{{"CC", p.CC}, {"CXX", p.CXX}, {"FC", p.FC}} {
+		if kv[1] != "" {
+			envs = append(envs, kv[0]+"="+kv[1])
+		}
+	}
+	keys := make([]string, 0, len(p.Env))
+	for k := range p.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		envs = append(envs, k+"="+p.Env[k])
+	}
+	return envs
+}
+
+// CMakeConfigArgs returns arguments of cmake configuration set by the profile.
+func (p *Profile) CMakeConfigArgs() string {
+	args := make([]string, 0, len(p.CMakeArgs)+1)
+	if p.ToolchainFile != "" {
+		args = append(args, fmt.Sprintf("-DCMAKE_TOOLCHAIN_FILE=\"%s\"", p.ToolchainFile))
+	}
+	args = append(args, p.CMakeArgs...)
+	return strings.Join(args, " ")
+}
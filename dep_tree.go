@@ -38,6 +38,13 @@ type PackageMeta struct {
 	SelfBuild    []string `yaml:"self_build"`     // inner builder (shows how this package is built, specified in package's pkg.yaml file)
 	CMakeLib     string   `yaml:"cmake_lib"`      // outer cmake script to add this lib.
 	SelfCMakeLib string   `yaml:"self_cmake_lib"` // inner cmake script to add this lib.
+	// effective args of this package: args declared in its pkg.yaml, overridden by config file and cli.
+	Args map[string]string `yaml:"args,omitempty"`
+	// target platform the package is fetched for (--target-os/--target-arch), used by .OS and .ARCH in templates.
+	Platform Platform `yaml:"platform,omitempty"`
+	// args from cli (-arg) while fetching, only recorded for the root package,
+	// thus they are kept when packages are fetched again by editing commands (e.g. `pkg add`).
+	FetchArgs map[string]string `yaml:"fetch_args,omitempty"`
 }
 
 func (ctx *PackageMeta) SetPackageName(key string) error {
@@ -112,6 +119,14 @@ func (ctx *PackageMeta) HasDiff(other PackageMeta) bool {
 	if !compareSliceSame(ctx.SelfBuild, other.SelfBuild) {
 		return true
 	}
+	if len(ctx.Args) != len(other.Args) {
+		return true
+	}
+	for k, v := range ctx.Args {
+		if otherValue, ok := other.Args[k]; !ok || otherValue != v {
+			return true
+		}
+	}
 	return false
 }
 
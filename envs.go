@@ -2,10 +2,13 @@ package pkg
 
 import (
 	"bytes"
+	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"strconv"
+	"strings"
 	"text/template"
 )
 
@@ -13,54 +16,199 @@ const pkgTagName = "pkg"
 
 // paths env variable used in instruction
 type PackageEnvs struct {
-	PkgRoot             string `pkg:"PKG_ROOT"`              // the path running pkg
-	VendorPath          string `pkg:"VENDOR_PATH"`           // vendor
-	PkgInCPath          string `pkg:"INCLUDE"`               // vendor/include
-	PackageCacheDir     string `pkg:"CACHE"`                 // vendor/cache/@pkg
-	PackagePkgDir       string `pkg:"PKG_DIR"`               // vendor/pkg/@pkg
-	PackagePkgIncDir    string `pkg:"PKG_INC"`               // vendor/pkg/@pkg/include
-	PackageSrcDir       string `pkg:"SRC_DIR"`               // vendor/src/@pkg
-	PackageFindPath     string `pkg:"PKG_FIND_PATH"`         // vendor/deps/@pkg or vendor/pkg/@pkg (decided by env)
-	CMakePackageFindDir string `pkg:"CMAKE_VENDOR_PATH_PKG"` // vendor/pkg/@pkg
+	PkgRoot             string            `pkg:"PKG_ROOT"`              // the path running pkg
+	VendorPath          string            `pkg:"VENDOR_PATH"`           // vendor
+	PkgInCPath          string            `pkg:"INCLUDE"`               // vendor/include
+	PackageCacheDir     string            `pkg:"CACHE"`                 // vendor/cache/@pkg/@config
+	PackagePkgDir       string            `pkg:"PKG_DIR"`               // vendor/pkg/@pkg (vendor/pkg-@config/@pkg for non-Release config)
+	PackagePkgIncDir    string            `pkg:"PKG_INC"`               // vendor/pkg/@pkg/include
+	PackageSrcDir       string            `pkg:"SRC_DIR"`               // vendor/src/@pkg
+	PackageFindPath     string            `pkg:"PKG_FIND_PATH"`         // vendor/deps/@pkg or vendor/pkg/@pkg (decided by env)
+	CMakePackageFindDir string            `pkg:"CMAKE_VENDOR_PATH_PKG"` // ${VENDOR_PATH}/${PKG_PREFIX_DIR}/@pkg
+	BuildType           string            `pkg:"BUILD_TYPE"`            // cmake build type, e.g. Release, Debug
+	Args                map[string]string `pkg:"args"`                  // args of the package, e.g. {{.args.BLAS_VENDOR}}
+	OS                  string            `pkg:"OS"`                    // target os, e.g. linux, darwin
+	Arch                string            `pkg:"ARCH"`                  // target arch, e.g. amd64, arm64
+	PackageName         string            `pkg:"PACKAGE"`               // package name, e.g. github.com/fmtlib/fmt
+	Version             string            `pkg:"VERSION"`               // package version
+	Target              string            `pkg:"TARGET"`                // cmake target name of the package
+	// metadata of all packages, used by template functions (e.g. srcdir) to find other packages.
+	Metas map[string]PackageMeta
+	// name of install prefix directory in vendor, e.g. pkg, pkg-debug
+	prefixDir string
 }
 
 // pkgRoot: the root directory of project
 // packageName: package name/path
 // packageSrcPath: path of package source
+// The variables are set for the default build type (Release), use SetBuildConfig to change it.
 func NewPackageEnvs(pkgRoot, packageName, packageSrc string) *PackageEnvs {
-	pkgFindPath := GetPackagePkgPath(pkgRoot, packageName)
-	if pkgEnvInc := os.Getenv("PKG_INNER_BUILD"); pkgEnvInc != "" {
-		pkgFindPath = GetPackageDepsPath(pkgRoot, packageName)
-	}
-	return &PackageEnvs{
+	envs := &PackageEnvs{
 		PkgRoot:             pkgRoot,
 		VendorPath:          GetVendorPath(pkgRoot),
 		PkgInCPath:          GetIncludePath(pkgRoot),
-		PackageCacheDir:     GetCachePath(pkgRoot, packageName),
-		PackagePkgDir:       GetPackagePkgPath(pkgRoot, packageName),
-		PackagePkgIncDir:    GetPkgIncludePath(pkgRoot, packageName),
 		PackageSrcDir:       packageSrc,
-		PackageFindPath:     pkgFindPath,
 		CMakePackageFindDir: GetCMakeVendorPkgPath(packageName),
+		OS:                  runtime.GOOS,
+		Arch:                runtime.GOARCH,
+		PackageName:         packageName,
 	}
+	envs.SetBuildConfig(DefaultBuildType, DefaultBuildType)
+	return envs
+}
+
+// SetBuildConfig sets the variables depending on the build config, e.g. the cmake build tree and install prefix.
+// config is the name of build config used in directory names, buildType is the cmake build type.
+func (envs *PackageEnvs) SetBuildConfig(config, buildType string) {
+	envs.BuildType = buildType
+	envs.PackageCacheDir = GetBuildCachePath(envs.PkgRoot, config, envs.PackageName)
+	envs.setPrefixDir(PkgPrefixDirName(config))
+}
+
+// SetCMakeBuildConfig sets the variables for generating cmake script (pkg.dep.cmake),
+// where the install prefix is selected by CMAKE_BUILD_TYPE at cmake configuration time.
+func (envs *PackageEnvs) SetCMakeBuildConfig() {
+	envs.BuildType = "${CMAKE_BUILD_TYPE}"
+	envs.setPrefixDir(CMakePkgPrefixDir)
+}
+
+func (envs *PackageEnvs) setPrefixDir(prefixDir string) {
+	envs.prefixDir = prefixDir
+	envs.PackagePkgDir = envs.pkgDir(envs.PackageName)
+	envs.PackagePkgIncDir = filepath.Join(envs.PackagePkgDir, VendorInclude)
+	envs.PackageFindPath = envs.PackagePkgDir
+	if pkgEnvInc := os.Getenv("PKG_INNER_BUILD"); pkgEnvInc != "" {
+		envs.PackageFindPath = GetPackageDepsPath(envs.PkgRoot, envs.PackageName)
+	}
+}
+
+// pkgDir returns the install directory of a package in the install prefix of the build config.
+func (envs *PackageEnvs) pkgDir(packageName string) string {
+	return filepath.Join(envs.PkgRoot, VendorName, envs.prefixDir, packageName)
+}
+
+// SetPackageMeta sets the variables from package metadata.
+func (envs *PackageEnvs) SetPackageMeta(meta *PackageMeta) {
+	envs.Args = meta.Args
+	envs.Version = meta.Version
+	envs.Target = meta.TargetName
+	// packages fetched by old versions of pkg have no platform, the current platform is used.
+	if meta.Platform.OS != "" {
+		envs.OS = meta.Platform.OS
+	}
+	if meta.Platform.Arch != "" {
+		envs.Arch = meta.Platform.Arch
+	}
+}
+
+// TemplateFuncs returns functions can be used in instruction templates.
+// envs can be nil if the functions are only used for parsing templates.
+func TemplateFuncs(envs *PackageEnvs) template.FuncMap {
+	// find another package by name in metas.
+	findMeta := func(name string) (PackageMeta, error) {
+		if envs != nil {
+			if meta, ok := envs.Metas[name]; ok {
+				return meta, nil
+			}
+		}
+		return PackageMeta{}, fmt.Errorf("package `%s` is not found in dependencies", name)
+	}
+	pkgRoot := func() string {
+		if envs == nil {
+			return ""
+		}
+		return envs.PkgRoot
+	}
+	pkgDir := func(name string) string {
+		if envs == nil {
+			return GetPackagePkgPath("", name)
+		}
+		return envs.pkgDir(name)
+	}
+	return template.FuncMap{
+		// env "NAME" "default": value of an environment variable, or the default value if it is not set.
+		"env": func(name string, def ...string) string {
+			if value, ok := os.LookupEnv(name); ok {
+				return value
+			}
+			return strings.Join(def, "")
+		},
+		// pkgdir "other/package": install directory of another package, vendor/pkg/@pkg (of the same build config).
+		"pkgdir": func(name string) (string, error) {
+			if _, err := findMeta(name); err != nil {
+				return "", err
+			}
+			return pkgDir(name), nil
+		},
+		// incdir "other/package": include directory of another package, vendor/pkg/@pkg/include.
+		"incdir": func(name string) (string, error) {
+			if _, err := findMeta(name); err != nil {
+				return "", err
+			}
+			return filepath.Join(pkgDir(name), VendorInclude), nil
+		},
+		// srcdir "other/package": source directory of another package, vendor/src/@pkg@version.
+		"srcdir": func(name string) (string, error) {
+			if meta, err := findMeta(name); err != nil {
+				return "", err
+			} else {
+				return meta.VendorSrcPath(pkgRoot()), nil
+			}
+		},
+		// join "sep" "a" "b": join strings with separator.
+		"join": func(sep string, elems ...string) string {
+			return strings.Join(elems, sep)
+		},
+		// replace "old" "new" "s": replace all old in s with new, e.g. {{.VERSION | replace "." "_"}}.
+		"replace": func(old, new, s string) string {
+			return strings.ReplaceAll(s, old, new)
+		},
+		// default "value" "s": s, or the default value if s is empty, e.g. {{.args.BLAS | default "openblas"}}.
+		// the value can be a missing key of args, which is nil here.
+		"default": func(def string, value interface{}) string {
+			if value == nil || fmt.Sprint(value) == "" {
+				return def
+			}
+			return fmt.Sprint(value)
+		},
+	}
+}
+
+// global variables used in instruction, besides the variables in PackageEnvs.
+const envCores = "CORES"
+
+// name of the variable for args of a package in templates, e.g. {{.args.BLAS_VENDOR}}.
+const argsVarName = "args"
+
+// TemplateVarNames returns names of all variables can be used in instruction templates.
+func TemplateVarNames() []string {
+	names := []string{envCores}
+	t := reflect.TypeOf(PackageEnvs{})
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get(pkgTagName); tag != "" {
+			names = append(names, tag)
+		}
+	}
+	return names
 }
 
 // replace origin string with args values.
 func ExpandEnv(origin string, envs *PackageEnvs) (string, error) {
-	var vars = make(map[string]string)
+	var vars = make(map[string]interface{})
 	// add global envs
-	vars["CORES"] = strconv.Itoa(runtime.NumCPU())
+	vars[envCores] = strconv.Itoa(runtime.NumCPU())
 	// convert struct to map (key is the tag).
 	t := reflect.TypeOf(*envs)
 	v := reflect.ValueOf(*envs)
 	for i := 0; i < t.NumField(); i++ {
 		// Get the field tag value
-		tag := t.Field(i).Tag.Get(pkgTagName)
-		vars[tag] = v.Field(i).Interface().(string)
+		if tag := t.Field(i).Tag.Get(pkgTagName); tag != "" {
+			vars[tag] = v.Field(i).Interface()
+		}
 	}
 
 	// template rendering
-	if t, err := template.New("o").Parse(origin); err != nil {
+	if t, err := template.New("o").Funcs(TemplateFuncs(envs)).Parse(origin); err != nil {
 		return "", err
 	} else {
 		sb := bytes.NewBufferString("")
@@ -15,3 +15,84 @@ func Test_ProcessEnv(t *testing.T) {
 		t.Errorf("test failed.%s - %s", s, newstr)
 	}
 }
+
+func TestExpandEnv_Args(t *testing.T) {
+	envs := NewPackageEnvs("", "example", "vendor/src/example")
+	envs.SetPackageMeta(&PackageMeta{Args: ResolveArgs(
+		map[string]string{"BLAS": "openblas", "MPI": "ON"},
+		map[string]string{"BLAS": "mkl", "UNKNOWN": "x"},
+	)})
+	s, err := ExpandEnv(`-DBLAS={{.args.BLAS}} -DMPI={{.args.MPI}}`, envs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "-DBLAS=mkl -DMPI=ON" {
+		t.Errorf("unexpected expanded string: %s", s)
+	}
+}
+
+func TestExpandEnv_Funcs(t *testing.T) {
+	t.Setenv("PKG_TEST_ENV", "on")
+	envs := NewPackageEnvs("/home", "example", "vendor/src/example")
+	envs.SetPackageMeta(&PackageMeta{PackageName: "example", Version: "v1.2.3", TargetName: "ex"})
+	envs.Metas = map[string]PackageMeta{
+		"github.com/foo/bar": {PackageName: "github.com/foo/bar", Version: "v2.0"},
+	}
+
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{`{{.PACKAGE}}@{{.VERSION}}#{{.TARGET}}`, "example@v1.2.3#ex"},
+		{`{{.VERSION | replace "." "_"}}`, "v1_2_3"},
+		{`{{env "PKG_TEST_ENV" "off"}} {{env "PKG_TEST_ENV_UNSET" "off"}}`, "on off"},
+		{`{{.args.BLAS | default "openblas"}}`, "openblas"},
+		{`{{join ";" "a" "b"}}`, "a;b"},
+		{`{{pkgdir "github.com/foo/bar"}}`, GetPackagePkgPath("/home", "github.com/foo/bar")},
+		{`{{incdir "github.com/foo/bar"}}`, GetPkgIncludePath("/home", "github.com/foo/bar")},
+		{`{{srcdir "github.com/foo/bar"}}`, getPackageVendorSrcPath("/home", "github.com/foo/bar", "v2.0")},
+	}
+	for _, tt := range tests {
+		if s, err := ExpandEnv(tt.tmpl, envs); err != nil {
+			t.Errorf("expand %s failed: %v", tt.tmpl, err)
+		} else if s != tt.want {
+			t.Errorf("expand %s: expect %s, but got %s", tt.tmpl, tt.want, s)
+		}
+	}
+
+	if _, err := ExpandEnv(`{{pkgdir "github.com/not/found"}}`, envs); err == nil {
+		t.Error("expect error for package not in dependencies")
+	}
+}
+
+func TestExpandEnv_BuildConfig(t *testing.T) {
+	envs := NewPackageEnvs("/home", "example", "vendor/src/example")
+	envs.Metas = map[string]PackageMeta{"dep": {PackageName: "dep"}}
+	tmpl := `{{.BUILD_TYPE}} {{.CACHE}} {{.PKG_DIR}} {{pkgdir "dep"}}`
+
+	envs.SetBuildConfig("Debug", "Debug")
+	if s, err := ExpandEnv(tmpl, envs); err != nil {
+		t.Fatal(err)
+	} else if want := "Debug /home/vendor/cache/example/Debug /home/vendor/pkg-debug/example /home/vendor/pkg-debug/dep"; s != want {
+		t.Errorf("expect %s, but got %s", want, s)
+	}
+
+	envs.SetCMakeBuildConfig()
+	if s, err := ExpandEnv(`{{.BUILD_TYPE}} {{.PKG_DIR}}`, envs); err != nil {
+		t.Fatal(err)
+	} else if want := "${CMAKE_BUILD_TYPE} /home/vendor/${PKG_PREFIX_DIR}/example"; s != want {
+		t.Errorf("expect %s, but got %s", want, s)
+	}
+}
+
+func TestExpandEnv_Platform(t *testing.T) {
+	envs := NewPackageEnvs("", "example", "vendor/src/example")
+	if s, err := ExpandEnv(`{{.OS}}/{{.ARCH}}`, envs); err != nil || s != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Fatalf("expect current platform without recorded platform, but got %s, %v", s, err)
+	}
+	// the platform recorded while fetching (e.g. --target-os) is used.
+	envs.SetPackageMeta(&PackageMeta{Platform: Platform{OS: "plan9", Arch: "riscv64"}})
+	if s, err := ExpandEnv(`{{.OS}}/{{.ARCH}}`, envs); err != nil || s != "plan9/riscv64" {
+		t.Errorf("expect recorded platform, but got %s, %v", s, err)
+	}
+}
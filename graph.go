@@ -1,82 +1,246 @@
 package pkg
 
 import (
-	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
-// dump direct and indirect dependencies packages of all packages.
-func (depTree *DependencyTree) MarshalGraph(writer io.Writer) error {
-	// dump direct and indirect dependencies of each package.
-	pkgTraversalFlag := make(map[string]bool)
+const (
+	GraphFormatDot     = "dot"
+	GraphFormatJson    = "json"
+	GraphFormatMermaid = "mermaid"
+)
+
+// GraphNode is a package node in the dependency graph.
+type GraphNode struct {
+	Name     string   `json:"name"` // package name (usually it is a path)
+	Version  string   `json:"version"`
+	Target   string   `json:"target,omitempty"` // cmake package name
+	Features []string `json:"features,omitempty"`
+	Optional bool     `json:"optional,omitempty"`
+}
+
+// GraphEdge is a direct dependency from package `From` to package `To`.
+type GraphEdge struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Optional bool     `json:"optional,omitempty"` // the dependency is an optional package
+	Features []string `json:"features,omitempty"` // features enabled on the dependency
+}
+
+// DependencyGraph is the machine-readable form of the dependency tree,
+// packages with the same name are merged into one node.
+type DependencyGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// Graph converts the dependency tree to a dependency graph.
+// Nodes and edges are listed in the order of the deep first traversal,
+// thus dependencies are always listed before the packages depending on them.
+func (depTree *DependencyTree) Graph() (*DependencyGraph, error) {
+	graph := DependencyGraph{Nodes: make([]GraphNode, 0), Edges: make([]GraphEdge, 0)}
+	nodeFlag := make(map[string]bool)
+	edgeFlag := make(map[string]bool)
 	err := depTree.TraversalDeep(func(tree *DependencyTree) error {
-		if _, ok := (pkgTraversalFlag)[tree.Context.PackageName]; ok {
+		if _, ok := nodeFlag[tree.Context.PackageName]; ok {
 			return nil // skip
 		}
-		p, err := tree.ListDepsName()
-		if err != nil {
-			return err
-		}
-		// write package name
-		if _, err := writer.Write(([]byte)(tree.Context.PackageName + ": ")); err != nil {
-			return err
-		}
-		// dump dependencies list to file.
-		for k, v := range p {
-			if _, err := writer.Write([]byte(v)); err != nil {
-				return err
+		nodeFlag[tree.Context.PackageName] = true
+		graph.Nodes = append(graph.Nodes, GraphNode{
+			Name:     tree.Context.PackageName,
+			Version:  tree.Context.Version,
+			Target:   tree.Context.TargetName,
+			Features: tree.Context.Features,
+			Optional: tree.Context.Optional,
+		})
+		for _, dep := range tree.Dependencies {
+			edgeKey := tree.Context.PackageName + "\n" + dep.Context.PackageName
+			if _, ok := edgeFlag[edgeKey]; ok {
+				continue
 			}
-			if k != len(p)-1 { // not the last one
-				if _, err := writer.Write([]byte(", ")); err != nil {
-					return err
-				}
-			}
-		}
-		// new line
-		if _, err := writer.Write([]byte("\n")); err != nil {
-			return err
+			edgeFlag[edgeKey] = true
+			graph.Edges = append(graph.Edges, GraphEdge{
+				From:     tree.Context.PackageName,
+				To:       dep.Context.PackageName,
+				Optional: dep.Context.Optional,
+				Features: dep.Context.Features,
+			})
 		}
-		pkgTraversalFlag[tree.Context.PackageName] = true
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return &graph, nil
 }
 
-func LoadListFromGraph(graphPath, packageName string) ([]string, error) {
-	if file, err := os.Open(graphPath); err != nil {
+// LoadGraph reads the dependency graph from a json file.
+// If the file does not exist, an error telling the user to fetch packages is returned,
+// including the case that only the graph file of old versions of pkg exists.
+func LoadGraph(graphPath string) (*DependencyGraph, error) {
+	content, err := os.ReadFile(graphPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			legacyPath := filepath.Join(filepath.Dir(graphPath), LegacyDepGraph)
+			if _, statErr := os.Stat(legacyPath); statErr == nil {
+				return nil, fmt.Errorf("graph file %s is written by an old version of pkg, please re-run `pkg fetch` to generate %s: %w", legacyPath, graphPath, err)
+			}
+			return nil, fmt.Errorf("graph file %s is not found, please run `pkg fetch` first: %w", graphPath, err)
+		}
 		return nil, err
-	} else {
-		defer file.Close()
-		reader := bufio.NewReader(file)
-		for {
-			if line, _, err := reader.ReadLine(); err != nil {
-				if err == io.EOF {
-					return nil, fmt.Errorf("package `%s` is not fount in grapg file", packageName)
-				} else {
-					return nil, err
-				}
-			} else {
-				sp := strings.SplitN(string(line), ":", 2)
-				if len(sp) != 2 {
-					return nil, fmt.Errorf("error format of graph file: %s", graphPath)
-				}
-				if strings.TrimSpace(sp[0]) == packageName {
-					l := strings.Split(sp[1], ",")
-					lists := make([]string, 0, len(l))
-					for i := 0; i < len(l); i++ {
-						if li := strings.TrimSpace(l[i]); li != "" {
-							lists = append(lists, li)
-						}
-					}
-					return lists, nil
-				}
+	}
+	var graph DependencyGraph
+	if err := json.Unmarshal(content, &graph); err != nil {
+		return nil, fmt.Errorf("error format of graph file %s: %w", graphPath, err)
+	}
+	return &graph, nil
+}
+
+// DirectDeps returns the direct dependencies of each package in the graph.
+// The key of the returned map is the package name.
+func (g *DependencyGraph) DirectDeps() map[string][]string {
+	deps := make(map[string][]string)
+	for _, e := range g.Edges {
+		deps[e.From] = append(deps[e.From], e.To)
+	}
+	return deps
+}
+
+// ListDeps lists all direct and indirect dependencies of a package,
+// the package itself is not included.
+// Dependencies are listed before the packages depending on them, thus the result can be used as build order.
+func (g *DependencyGraph) ListDeps(packageName string) ([]string, error) {
+	found := false
+	for _, n := range g.Nodes {
+		if n.Name == packageName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("package `%s` is not found in graph file", packageName)
+	}
+
+	directDeps := g.DirectDeps()
+	visited := map[string]bool{packageName: true}
+	lists := make([]string, 0)
+	var visit func(name string)
+	visit = func(name string) {
+		for _, dep := range directDeps[name] {
+			if _, ok := visited[dep]; ok {
+				continue
 			}
+			visited[dep] = true
+			visit(dep)
+			lists = append(lists, dep)
+		}
+	}
+	visit(packageName)
+	return lists, nil
+}
+
+// WriteJson writes the graph in json format.
+func (g *DependencyGraph) WriteJson(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(g)
+}
+
+// WriteDot writes the graph in graphviz dot format.
+func (g *DependencyGraph) WriteDot(writer io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph pkg {\n")
+	sb.WriteString("    node [shape=box];\n")
+	for _, n := range g.Nodes {
+		style := ""
+		if n.Optional {
+			style = ", style=dashed"
+		}
+		sb.WriteString(fmt.Sprintf("    %q [label=%q%s];\n", n.Name, graphNodeLabel(n, "\n"), style))
+	}
+	for _, e := range g.Edges {
+		var attrs []string
+		if e.Optional {
+			attrs = append(attrs, "style=dashed")
+		}
+		if len(e.Features) != 0 {
+			attrs = append(attrs, fmt.Sprintf("label=%q", strings.Join(e.Features, ",")))
+		}
+		if len(attrs) == 0 {
+			sb.WriteString(fmt.Sprintf("    %q -> %q;\n", e.From, e.To))
+		} else {
+			sb.WriteString(fmt.Sprintf("    %q -> %q [%s];\n", e.From, e.To, strings.Join(attrs, ", ")))
+		}
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(writer, sb.String())
+	return err
+}
+
+// WriteMermaid writes the graph in mermaid flowchart format.
+func (g *DependencyGraph) WriteMermaid(writer io.Writer) error {
+	ids := make(map[string]string)
+	for i, n := range g.Nodes {
+		ids[n.Name] = fmt.Sprintf("n%d", i)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("graph TD\n")
+	for _, n := range g.Nodes {
+		label := strings.ReplaceAll(graphNodeLabel(n, "<br/>"), `"`, "#quot;")
+		sb.WriteString(fmt.Sprintf("    %s[\"%s\"]\n", ids[n.Name], label))
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Optional {
+			arrow = "-.->"
+		}
+		if len(e.Features) != 0 {
+			label := strings.ReplaceAll(strings.Join(e.Features, ","), `"`, "#quot;")
+			sb.WriteString(fmt.Sprintf("    %s %s|\"%s\"| %s\n", ids[e.From], arrow, label, ids[e.To]))
+		} else {
+			sb.WriteString(fmt.Sprintf("    %s %s %s\n", ids[e.From], arrow, ids[e.To]))
 		}
 	}
+	_, err := io.WriteString(writer, sb.String())
+	return err
+}
+
+// Write writes the graph in the given format (dot, json or mermaid).
+func (g *DependencyGraph) Write(writer io.Writer, format string) error {
+	switch format {
+	case GraphFormatDot:
+		return g.WriteDot(writer)
+	case GraphFormatJson:
+		return g.WriteJson(writer)
+	case GraphFormatMermaid:
+		return g.WriteMermaid(writer)
+	default:
+		return fmt.Errorf("unsupported graph format `%s`", format)
+	}
+}
+
+// label of a node: name@version, with target name if it is set.
+func graphNodeLabel(n GraphNode, sep string) string {
+	label := n.Name
+	if n.Version != "" {
+		label += "@" + n.Version
+	}
+	if n.Target != "" {
+		label += sep + "target: " + n.Target
+	}
+	return label
+}
+
+func LoadListFromGraph(graphPath, packageName string) ([]string, error) {
+	if graph, err := LoadGraph(graphPath); err != nil {
+		return nil, err
+	} else {
+		return graph.ListDeps(packageName)
+	}
 }
@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDependencyGraph_ListDeps(t *testing.T) {
+	var root, a, b, c, d DependencyTree
+	root.Context.PackageName = "r"
+	a.Context = PackageMeta{PackageName: "a", Version: "v1"}
+	b.Context = PackageMeta{PackageName: "b", Version: "v2", Optional: true}
+	c.Context = PackageMeta{PackageName: "c", Version: "v3", Features: []string{"X=ON"}}
+	d.Context = PackageMeta{PackageName: "c", Version: "v3", Features: []string{"X=ON"}}
+
+	a.Dependencies = append(a.Dependencies, &c)
+	b.Dependencies = append(b.Dependencies, &d)
+	root.Dependencies = append(root.Dependencies, &a, &b)
+	// root -> {a -> {c}, b -> {c}}
+
+	graph, err := root.Graph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Nodes) != 4 || len(graph.Edges) != 4 {
+		t.Fatalf("unexpected graph size, nodes: %d, edges: %d", len(graph.Nodes), len(graph.Edges))
+	}
+
+	lists, err := graph.ListDeps("r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lists, ",") != "c,a,b" {
+		t.Errorf("unexpected build order of dependencies: %v", lists)
+	}
+	if _, err := graph.ListDeps("not-exist"); err == nil {
+		t.Error("package not in graph must return an error")
+	}
+}
+
+func TestDependencyGraph_Write(t *testing.T) {
+	graph := DependencyGraph{
+		Nodes: []GraphNode{{Name: "root"}, {Name: "a", Version: "v1", Target: "A"}},
+		Edges: []GraphEdge{{From: "root", To: "a", Optional: true, Features: []string{"X=ON"}}},
+	}
+
+	var buf bytes.Buffer
+	if err := graph.Write(&buf, GraphFormatDot); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"root" -> "a" [style=dashed, label="X=ON"];`) {
+		t.Errorf("unexpected dot output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := graph.Write(&buf, GraphFormatMermaid); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `n0 -.->|"X=ON"| n1`) {
+		t.Errorf("unexpected mermaid output:\n%s", buf.String())
+	}
+
+	if err := graph.Write(&buf, "svg"); err == nil {
+		t.Error("unsupported format must return an error")
+	}
+}
+
+func TestLoadGraph_Legacy(t *testing.T) {
+	home := t.TempDir()
+	graphPath := GetDepGraphPath(home)
+	if _, err := LoadGraph(graphPath); err == nil || !os.IsNotExist(errors.Unwrap(err)) || !strings.Contains(err.Error(), "pkg fetch") {
+		t.Fatalf("expect not found error telling to run `pkg fetch`, but got %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(graphPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(graphPath), LegacyDepGraph), []byte("root: a\na: \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadGraph(graphPath); err == nil || !strings.Contains(err.Error(), LegacyDepGraph) || !strings.Contains(err.Error(), "re-run `pkg fetch`") {
+		t.Fatalf("expect error telling to re-run `pkg fetch` for legacy graph, but got %v", err)
+	}
+}
@@ -12,52 +12,103 @@ type InsTriple struct {
 	Third  string
 }
 
-// todo parse multiple space, and `\"`
+// ParseIns parses an instruction string into a triple.
+// The first and second are words split by POSIX shell rules: words are separated by blanks (spaces and tabs),
+// and quotes (single and double) and backslash escapes are supported, e.g. `CP "path with space" des`.
+// The third is the remaining string which is kept as it is (e.g. shell command of RUN instruction),
+// unless it is a single word, in which case the quotes are removed, e.g. `RUN ./ "make && make install"`.
 func ParseIns(insStr string) (ins InsTriple, err error) {
-	insStr = strings.Trim(insStr, " ")
+	var rest string
 	// parse cmd (the first) of instruction.
-	cmdAndLater := strings.SplitN(insStr, " ", 2)
-	if len(cmdAndLater) != 2 && len(cmdAndLater) != 1 {
-		return ins, fmt.Errorf("syntax error of instruction `%s`", insStr)
+	if ins.First, rest, err = nextInsWord(insStr); err != nil {
+		return ins, fmt.Errorf("syntax error of instruction `%s`: %w", insStr, err)
+	}
+	// parse second of instruction.
+	if ins.Second, rest, err = nextInsWord(rest); err != nil {
+		return ins, fmt.Errorf("syntax error of instruction `%s`: %w", insStr, err)
+	}
+	// parse third
+	rest = strings.Trim(rest, insBlanks)
+	if third, more, err := nextInsWord(rest); err == nil && strings.Trim(more, insBlanks) == "" {
+		ins.Third = third
 	} else {
-		ins.First = cmdAndLater[0]
+		ins.Third = rest
 	}
+	return ins, nil
+}
 
-	// first only
-	if len(cmdAndLater) == 1 {
-		return ins, nil
-	}
+const insBlanks = " \t\r\n"
 
-	// parse second of instruction.
-	if strings.HasPrefix(cmdAndLater[1], `"`) {
-		// example: `CP "../path" "./des" `
-		secondAndLater := strings.SplitN(cmdAndLater[1][1:], `"`, 2)
-		// there must at least 2 ", so len must be 2.
-		if len(secondAndLater) != 2 {
-			return ins, fmt.Errorf("syntax error of instruction `%s`", insStr)
-		} else {
-			ins.Second = strings.TrimSpace(secondAndLater[0])
-			ins.Third = strings.TrimSpace(secondAndLater[1]) // may with `"`
-		}
-	} else {
-		// example: `CP ../path ./des`, `CP ../path`, `CP ../path "./des"`,
-		secondAndLater := strings.SplitN(cmdAndLater[1], ` `, 2)
-		if len(secondAndLater) == 2 {
-			ins.Second = secondAndLater[0]
-			ins.Third = secondAndLater[1]
-		} else if len(secondAndLater) == 1 {
-			ins.Second = secondAndLater[0]
-		} else {
-			return ins, fmt.Errorf("syntax error of instruction `%s`", insStr)
+// nextInsWord reads the next word from s by POSIX shell rules,
+// and returns the word (with quotes and escapes removed) and the remaining string.
+// Leading blanks are skipped, and an empty word is returned if there is no word.
+func nextInsWord(s string) (string, string, error) {
+	s = strings.TrimLeft(s, insBlanks)
+	var word strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case strings.IndexByte(insBlanks, c) >= 0:
+			return word.String(), s[i:], nil
+		case c == '\\':
+			if i+1 == len(s) {
+				return "", "", fmt.Errorf("unterminated backslash escape")
+			}
+			i++
+			if s[i] != '\n' { // backslash-newline is a line continuation.
+				word.WriteByte(s[i])
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return "", "", fmt.Errorf("unterminated single-quoted string")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			closed := false
+			for i++; i < len(s); i++ {
+				if s[i] == '"' {
+					closed = true
+					break
+				}
+				// in double quotes, backslash only escapes $ ` " \ and newline.
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(s[i])
+			}
+			if !closed {
+				return "", "", fmt.Errorf("unterminated double-quoted string")
+			}
+		default:
+			word.WriteByte(c)
 		}
 	}
+	return word.String(), "", nil
+}
 
-	// parse third
-	ins.Third = strings.TrimSpace(ins.Third)
-	if strings.HasPrefix(ins.Third, `"`) && strings.HasSuffix(ins.Third, `"`) {
-		// it does not process instructions like `echo "hello"`
-		ins.Third = strings.Trim(ins.Third, `"`)
+// SplitInsWords splits a string (e.g. the third of InsTriple) into words by POSIX shell rules.
+func SplitInsWords(s string) ([]string, error) {
+	words := make([]string, 0)
+	for strings.Trim(s, insBlanks) != "" {
+		word, rest, err := nextInsWord(s)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, word)
+		s = rest
 	}
+	return words, nil
+}
 
-	return ins, err
+// QuoteInsWord quotes a word by single quotes if needed, thus it can be parsed by ParseIns as a single word.
+func QuoteInsWord(word string) string {
+	if word != "" && !strings.ContainsAny(word, insBlanks+`\'"`) {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
 }
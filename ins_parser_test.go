@@ -1,7 +1,10 @@
 package pkg
 
 import (
+	"strings"
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestParseInsCmdOnly(t *testing.T) {
@@ -67,7 +70,80 @@ func TestParseInsSecondQ(t *testing.T) {
 	if ins, err := ParseIns(`CP "C"`); err != nil || ins.Second != "C" {
 		t.Error("test error of ins second parsing")
 	}
-	if ins, err := ParseIns("CP \"C \""); err != nil || ins.Second != "C" {
+	// spaces in quotes are kept.
+	if ins, err := ParseIns("CP \"C \""); err != nil || ins.Second != "C " {
 		t.Error("test error of ins second parsing")
 	}
 }
+
+func TestParseInsShellWords(t *testing.T) {
+	tests := []struct {
+		ins  string
+		want InsTriple
+	}{
+		{`CP "path with space/a.h" "des dir/"`, InsTriple{"CP", "path with space/a.h", "des dir/"}},
+		{`CP path\ with\ space/a.h des`, InsTriple{"CP", "path with space/a.h", "des"}},
+		{"CP\tsrc\t\tdes", InsTriple{"CP", "src", "des"}},
+		{`CP 'it''s' "say \"hi\""`, InsTriple{"CP", "its", `say "hi"`}},
+		{`RUN "build dir" make && make install`, InsTriple{"RUN", "build dir", "make && make install"}},
+		{`RUN ./ "make && make install"`, InsTriple{"RUN", "./", "make && make install"}},
+		{`RUN ./ echo "hello world"`, InsTriple{"RUN", "./", `echo "hello world"`}},
+		{`CMAKE "-DA=1 -DB=2" --verbose`, InsTriple{"CMAKE", "-DA=1 -DB=2", "--verbose"}},
+	}
+	for _, tt := range tests {
+		if ins, err := ParseIns(tt.ins); err != nil {
+			t.Errorf("parse `%s` failed: %v", tt.ins, err)
+		} else if ins != tt.want {
+			t.Errorf("parse `%s`: expect %+v, but got %+v", tt.ins, tt.want, ins)
+		}
+	}
+
+	for _, bad := range []string{`CP 'src des`, `CP "src des`, `CP src\`} {
+		if _, err := ParseIns(bad); err == nil {
+			t.Errorf("expect syntax error of `%s`", bad)
+		}
+	}
+}
+
+func TestQuoteInsWord(t *testing.T) {
+	for _, word := range []string{"", "simple", "with space", "it's", `say "hi"`, "tab\there"} {
+		if ins, err := ParseIns("CP " + QuoteInsWord(word) + " " + QuoteInsWord(word)); err != nil {
+			t.Errorf("parse quoted word `%s` failed: %v", word, err)
+		} else if ins.Second != word || ins.Third != word {
+			t.Errorf("expect word `%s`, but got %+v", word, ins)
+		}
+	}
+}
+
+func TestYamlInstructions(t *testing.T) {
+	content := `
+- CMAKE -DFOO=ON
+- run: {dir: "{{.CACHE}}/build dir", cmd: "make && make install"}
+- cp: {src: "it's.h", dst: "{{.INCLUDE}}"}
+- auto_pkg:
+`
+	var list YamlInstructions
+	if err := yaml.Unmarshal([]byte(content), &list); err != nil {
+		t.Fatal(err)
+	}
+	want := []InsTriple{
+		{"CMAKE", "-DFOO=ON", ""},
+		{"RUN", "{{.CACHE}}/build dir", "make && make install"},
+		{"CP", "it's.h", "{{.INCLUDE}}"},
+		{"AUTO_PKG", "", ""},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("expect %d instructions, but got %v", len(want), list)
+	}
+	for i, ins := range list.Strings() {
+		if triple, err := ParseIns(ins); err != nil {
+			t.Errorf("parse instruction `%s` failed: %v", ins, err)
+		} else if triple != want[i] {
+			t.Errorf("instruction %d: expect %+v, but got %+v", i, want[i], triple)
+		}
+	}
+
+	if err := yaml.Unmarshal([]byte(`- copy: {src: a}`), &list); err == nil || !strings.Contains(err.Error(), "unknown instruction `copy`") {
+		t.Errorf("expect unknown instruction error, but got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// InstalledEnvVar is an environment variable of path list, pointing to directories of installed packages.
+type InstalledEnvVar struct {
+	Name  string
+	Paths []string
+}
+
+// installedEnvDirs are the sub-directories of install prefix added to each environment variable.
+// Empty string is the install prefix itself.
+var installedEnvDirs = []struct {
+	name string
+	dirs []string
+}{
+	{"PATH", []string{"bin"}},
+	{"LD_LIBRARY_PATH", []string{VendorLib, VendorLib64}},
+	{"PKG_CONFIG_PATH", []string{"lib/pkgconfig", "lib64/pkgconfig", "share/pkgconfig"}},
+	{"CMAKE_PREFIX_PATH", []string{""}},
+	{"CPATH", []string{VendorInclude}},
+	{"LIBRARY_PATH", []string{VendorLib, VendorLib64}},
+}
+
+// InstalledEnv returns the environment variables for using the installed packages of a build config
+// (e.g. Release, Debug, or @profile-@buildType) without cmake.
+// Only existing directories are added. The shared include directory (vendor/include) is also added to CPATH.
+func InstalledEnv(base, config string, metas map[string]PackageMeta) []InstalledEnvVar {
+	names := make([]string, 0, len(metas))
+	for name := range metas {
+		if name != RootPKG {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	vars := make([]InstalledEnvVar, 0, len(installedEnvDirs))
+	for _, envDirs := range installedEnvDirs {
+		v := InstalledEnvVar{Name: envDirs.name, Paths: make([]string, 0)}
+		for _, name := range names {
+			prefix := GetPackagePkgPathOf(base, config, name)
+			for _, dir := range envDirs.dirs {
+				if path := filepath.Join(prefix, filepath.FromSlash(dir)); isDir(path) {
+					v.Paths = append(v.Paths, path)
+				}
+			}
+		}
+		if envDirs.name == "CPATH" && isDir(GetIncludePath(base)) {
+			v.Paths = append(v.Paths, GetIncludePath(base))
+		}
+		vars = append(vars, v)
+	}
+	return vars
+}
+
+// LoadInstalledEnv returns the environment variables for using the installed packages (see InstalledEnv)
+// of all packages in sum file @base/vendor/pkg.sum.yaml.
+func LoadInstalledEnv(base, config string) ([]InstalledEnvVar, error) {
+	pkgSumPath := GetPkgSumPath(base)
+	if _, err := os.Stat(pkgSumPath); err != nil {
+		return nil, fmt.Errorf(`stat file %s failed, make sure you have run "pkg fetch" and "pkg install"; error: %s`, pkgSumPath, err)
+	}
+	var metas map[string]PackageMeta
+	if err := DepTreeRecover(&metas, pkgSumPath); err != nil {
+		return nil, err
+	}
+	return InstalledEnv(base, config, metas), nil
+}
+
+// Value returns the value of the variable, paths are prepended to the existing value.
+func (v InstalledEnvVar) Value(existing string) string {
+	paths := append([]string{}, v.Paths...)
+	if existing != "" {
+		paths = append(paths, existing)
+	}
+	return strings.Join(paths, string(os.PathListSeparator))
+}
+
+// Environ returns a copy of environ (in the form "key=value") with the variables set,
+// paths of the variables are prepended to the existing values.
+func Environ(environ []string, vars []InstalledEnvVar) []string {
+	result := append([]string{}, environ...)
+	for _, v := range vars {
+		if len(v.Paths) == 0 {
+			continue
+		}
+		found := false
+		for i, kv := range result {
+			if key, value, ok := strings.Cut(kv, "="); ok && key == v.Name {
+				result[i] = v.Name + "=" + v.Value(value)
+				found = true
+			}
+		}
+		if !found {
+			result = append(result, v.Name+"="+v.Value(""))
+		}
+	}
+	return result
+}
+
+// LookPath searches an executable named file in the PATH of environ (e.g. returned by Environ),
+// unlike exec.LookPath which uses PATH of the current process.
+// If file contains a path separator, it is returned directly.
+func LookPath(file string, environ []string) (string, error) {
+	if strings.ContainsRune(file, '/') || strings.ContainsRune(file, filepath.Separator) {
+		return file, nil
+	}
+	path := ""
+	for _, kv := range environ {
+		if key, value, ok := strings.Cut(kv, "="); ok && key == "PATH" {
+			path = value
+		}
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		// exec.LookPath checks the file directly (with extensions in PATHEXT on Windows) if it contains a separator.
+		if found, err := exec.LookPath(filepath.Join(dir, file)); err == nil {
+			return found, nil
+		}
+	}
+	return "", fmt.Errorf("executable file `%s` not found in PATH: %w", file, exec.ErrNotFound)
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
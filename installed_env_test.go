@@ -0,0 +1,84 @@
+package pkg
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestInstalledEnv(t *testing.T) {
+	base := t.TempDir()
+	for _, dir := range []string{"pkg/foo/bin", "pkg/foo/lib/pkgconfig", "pkg/bar/include", "pkg-debug/foo/lib64", "include"} {
+		if err := os.MkdirAll(filepath.Join(GetVendorPath(base), dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metas := map[string]PackageMeta{"foo": {PackageName: "foo"}, "bar": {PackageName: "bar"}, RootPKG: {PackageName: RootPKG}}
+
+	vars := make(map[string][]string)
+	for _, v := range InstalledEnv(base, DefaultBuildType, metas) {
+		vars[v.Name] = v.Paths
+	}
+	expect := map[string][]string{
+		"PATH":              {GetPackagePkgPath(base, "foo") + "/bin"},
+		"LD_LIBRARY_PATH":   {GetPackagePkgPath(base, "foo") + "/lib"},
+		"PKG_CONFIG_PATH":   {GetPackagePkgPath(base, "foo") + "/lib/pkgconfig"},
+		"CMAKE_PREFIX_PATH": {GetPackagePkgPath(base, "bar"), GetPackagePkgPath(base, "foo")},
+		"CPATH":             {GetPackagePkgPath(base, "bar") + "/include", GetIncludePath(base)},
+		"LIBRARY_PATH":      {GetPackagePkgPath(base, "foo") + "/lib"},
+	}
+	for name, paths := range expect {
+		if strings.Join(vars[name], ":") != strings.Join(paths, ":") {
+			t.Errorf("expect %s=%v, but got %v", name, paths, vars[name])
+		}
+	}
+
+	// packages of another build config.
+	for _, v := range InstalledEnv(base, "Debug", metas) {
+		if v.Name == "LD_LIBRARY_PATH" && (len(v.Paths) != 1 || v.Paths[0] != GetPackagePkgPathOf(base, "Debug", "foo")+"/lib64") {
+			t.Errorf("unexpected LD_LIBRARY_PATH of Debug config: %v", v.Paths)
+		}
+	}
+
+	environ := Environ([]string{"PATH=/usr/bin", "HOME=/home"}, []InstalledEnvVar{{Name: "PATH", Paths: []string{"/a/bin"}}, {Name: "CPATH", Paths: []string{"/a/include"}}})
+	if strings.Join(environ, " ") != "PATH=/a/bin"+string(os.PathListSeparator)+"/usr/bin HOME=/home CPATH=/a/include" {
+		t.Errorf("unexpected environ: %v", environ)
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script is not executable on windows")
+	}
+	base := t.TempDir()
+	bin := filepath.Join(GetPackagePkgPath(base, "foo"), "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tool := filepath.Join(bin, "foo-tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\necho foo\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	metas := map[string]PackageMeta{"foo": {PackageName: "foo"}}
+
+	// the tool installed by the package is not in PATH of the current process.
+	environ := Environ([]string{"PATH=/usr/bin:/bin"}, InstalledEnv(base, DefaultBuildType, metas))
+	if path, err := LookPath("foo-tool", environ); err != nil || path != tool {
+		t.Fatalf("expect %s found, but got %s, %v", tool, path, err)
+	}
+	cmd := exec.Command(tool)
+	cmd.Env = environ
+	if out, err := cmd.Output(); err != nil || string(out) != "foo\n" {
+		t.Errorf("unexpected output of installed tool: %q, %v", out, err)
+	}
+	if _, err := LookPath("foo-tool", []string{"PATH=/usr/bin:/bin"}); !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("expect not found error, but got %v", err)
+	}
+	if path, err := LookPath("./foo-tool", nil); err != nil || path != "./foo-tool" {
+		t.Errorf("expect path with separator returned directly, but got %s, %v", path, err)
+	}
+}
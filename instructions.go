@@ -1,7 +1,120 @@
 package pkg
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
 // this shows the supported instructions in pkg
 const (
-	InsCmake   = "CMAKE" // run cmake configuration and build,install
-	InsAutoPkg = "AUTO_PKG"
+	InsCp        = "CP"    // copy files
+	InsRun       = "RUN"   // run a shell command in a directory
+	InsCmake     = "CMAKE" // run cmake configuration and build,install
+	InsAutoPkg   = "AUTO_PKG"
+	InsAutotools = "AUTOTOOLS" // run configure script, make and make install
+	InsMeson     = "MESON"     // run meson setup, compile and install
+	InsMake      = "MAKE"      // run make and make install with a copy of source in the cache directory
+	InsEnv       = "ENV"       // set an environment variable for later instructions of the package
+	InsMkdir     = "MKDIR"     // create a directory (and its parents)
+	InsRm        = "RM"        // remove a file or directory
+	InsPatch     = "PATCH"     // apply a patch file to the package source
+	InsDownload  = "DOWNLOAD"  // download a file and check its sha256 checksum
 )
+
+// Instructions lists all supported instructions.
+var Instructions = []string{InsCp, InsRun, InsCmake, InsAutoPkg, InsAutotools, InsMeson, InsMake,
+	InsEnv, InsMkdir, InsRm, InsPatch, InsDownload}
+
+// IsValidIns returns true if the instruction name is supported.
+func IsValidIns(name string) bool {
+	for _, ins := range Instructions {
+		if ins == name {
+			return true
+		}
+	}
+	return false
+}
+
+// names of arguments of instructions in structured form, in the order of the words in string form.
+var structuredInsArgs = map[string][]string{
+	InsCp:        {"src", "dst"},
+	InsRun:       {"dir", "cmd"},
+	InsCmake:     {"config", "build"},
+	InsAutoPkg:   {},
+	InsAutotools: {"configure", "build"},
+	InsMeson:     {"setup", "compile"},
+	InsMake:      {"build", "install"},
+	InsEnv:       {"key", "value"},
+	InsMkdir:     {"path"},
+	InsRm:        {"path"},
+	InsPatch:     {"file", "strip"},
+	InsDownload:  {"url", "dest", "sha256"},
+}
+
+// YamlInstruction is a building instruction in pkg.yaml file.
+// It can be a string, e.g. `RUN {{.CACHE}} make`,
+// or a mapping in structured form, e.g. `run: {dir: "{{.CACHE}}", cmd: make}`,
+// which is converted to the string form while parsing.
+type YamlInstruction string
+
+// YamlInstructions is a list of building instructions.
+type YamlInstructions []YamlInstruction
+
+// Strings returns instructions in string form.
+func (list YamlInstructions) Strings() []string {
+	if list == nil {
+		return nil
+	}
+	ins := make([]string, len(list))
+	for i, item := range list {
+		ins[i] = string(item)
+	}
+	return ins
+}
+
+func (ins *YamlInstruction) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*ins = YamlInstruction(value.Value)
+		return nil
+	}
+	if value.Kind != yaml.MappingNode || len(value.Content) != 2 {
+		return insYamlError(value, "instruction must be a string or a mapping with a single key (the instruction name)")
+	}
+	name := strings.ToUpper(value.Content[0].Value)
+	argNames, ok := structuredInsArgs[name]
+	if !ok {
+		return insYamlError(value, "unknown instruction `%s`, supported instructions: %s", value.Content[0].Value, strings.Join(Instructions, ", "))
+	}
+	var args map[string]string
+	if err := value.Content[1].Decode(&args); err != nil {
+		return err
+	}
+	words := []string{name}
+	for i, argName := range argNames {
+		arg, ok := args[argName]
+		if !ok && i != 0 {
+			break // the later arguments can be omitted.
+		}
+		words = append(words, QuoteInsWord(arg))
+		delete(args, argName)
+	}
+	if len(args) != 0 {
+		unknown := make([]string, 0, len(args))
+		for argName := range args {
+			unknown = append(unknown, argName)
+		}
+		sort.Strings(unknown)
+		return insYamlError(value, "unknown argument `%s` of instruction `%s`, supported arguments: %s",
+			strings.Join(unknown, ", "), value.Content[0].Value, strings.Join(argNames, ", "))
+	}
+	*ins = YamlInstruction(strings.Join(words, " "))
+	return nil
+}
+
+// insYamlError returns an error of yaml decoding with the line of the node.
+func insYamlError(node *yaml.Node, format string, a ...interface{}) error {
+	return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: ", node.Line) + fmt.Sprintf(format, a...)}}
+}
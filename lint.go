@@ -0,0 +1,475 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LintError is a problem found in pkg.yaml file.
+type LintError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e LintError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+type pkgLinter struct {
+	errors []LintError
+	args   map[string]string // args declared in pkg.yaml, used to check `.args.NAME` in templates. nil for skipping the check.
+}
+
+func (l *pkgLinter) report(node *yaml.Node, format string, a ...interface{}) {
+	l.errors = append(l.errors, LintError{Line: node.Line, Column: node.Column, Message: fmt.Sprintf(format, a...)})
+}
+
+// error of yaml syntax, e.g. "yaml: line 3: mapping values are not allowed in this context"
+var yamlErrorLineRegexp = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// LintPkgYaml checks content of a pkg.yaml file, and returns all problems found, sorted by position.
+// It checks unknown keys and wrong value types, the format version, instructions,
+// variables used in templates and the packages and features referred by features.
+func LintPkgYaml(content []byte) []LintError {
+	var l pkgLinter
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		if match := yamlErrorLineRegexp.FindStringSubmatch(err.Error()); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			return []LintError{{Line: line, Column: 1, Message: match[2]}}
+		}
+		return []LintError{{Line: 1, Column: 1, Message: err.Error()}}
+	}
+	if doc.Kind == 0 || len(doc.Content) == 0 {
+		return []LintError{{Line: 1, Column: 1, Message: "empty file"}}
+	}
+	root := doc.Content[0]
+
+	// check keys and types by the definition of YamlPkg.
+	l.lintType(root, reflect.TypeOf(YamlPkg{}), "")
+	if len(l.errors) != 0 {
+		return l.sortedErrors() // the following checks rely on correct types.
+	}
+
+	// strict decoding, unknown fields are not allowed.
+	var pkgYaml YamlPkg
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&pkgYaml); err != nil {
+		l.report(root, "%s", err)
+		return l.sortedErrors()
+	}
+	l.lintFormatVersion(root, &pkgYaml)
+	l.lintTemplates(root, &pkgYaml)
+	l.lintFeatures(root, &pkgYaml)
+	l.lintConditions(root)
+	return l.sortedErrors()
+}
+
+func (l *pkgLinter) sortedErrors() []LintError {
+	sort.SliceStable(l.errors, func(i, j int) bool {
+		if l.errors[i].Line != l.errors[j].Line {
+			return l.errors[i].Line < l.errors[j].Line
+		}
+		return l.errors[i].Column < l.errors[j].Column
+	})
+	return l.errors
+}
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// lintType checks node against type t, path is the key path of the node used in messages.
+func (l *pkgLinter) lintType(node *yaml.Node, t reflect.Type, path string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return // empty value is always allowed.
+	}
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		l.lintDecode(node, t, path)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		l.lintType(node, t.Elem(), path)
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			l.report(node, "`%s` must be a mapping", path)
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		yamlStructFields(t, fields)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if fieldType, ok := fields[key.Value]; ok {
+				l.lintType(value, fieldType, joinKeyPath(path, key.Value))
+			} else if suggestion := similarKey(key.Value, fields); suggestion != "" {
+				l.report(key, "unknown field `%s` in `%s`, did you mean `%s`?", key.Value, pathOrTop(path), suggestion)
+			} else {
+				l.report(key, "unknown field `%s` in `%s`", key.Value, pathOrTop(path))
+			}
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			l.report(node, "`%s` must be a mapping", path)
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			l.lintDecode(key, t.Key(), path)
+			l.lintType(value, t.Elem(), joinKeyPath(path, key.Value))
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			l.report(node, "`%s` must be a list", path)
+			return
+		}
+		for i, item := range node.Content {
+			l.lintType(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			l.report(node, "`%s` must be a %s", path, t.Kind())
+			return
+		}
+		l.lintDecode(node, t, path)
+	}
+}
+
+// lintDecode checks value type by decoding node to a new value of type t.
+func (l *pkgLinter) lintDecode(node *yaml.Node, t reflect.Type, path string) {
+	if err := node.Decode(reflect.New(t).Interface()); err != nil {
+		if typeErr, ok := err.(*yaml.TypeError); ok && len(typeErr.Errors) != 0 {
+			// remove the "line N:" prefix, the position is reported in LintError.
+			msg := typeErr.Errors[0]
+			if i := strings.Index(msg, ": "); strings.HasPrefix(msg, "line ") && i > 0 {
+				msg = msg[i+2:]
+			}
+			l.report(node, "invalid value of `%s`: %s", path, msg)
+		} else {
+			l.report(node, "invalid value of `%s`: %s", path, err)
+		}
+	}
+}
+
+// yamlStructFields collects yaml field names and types of struct t, including inline fields.
+func yamlStructFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("yaml")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(tag, ",inline") {
+			yamlStructFields(field.Type, fields)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+}
+
+func joinKeyPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func pathOrTop(path string) string {
+	if path == "" {
+		return PkgFileName
+	}
+	return path
+}
+
+// similarKey returns the known key with the smallest edit distance to key, if the distance is small enough.
+func similarKey(key string, fields map[string]reflect.Type) string {
+	best, bestDist := "", len(key)/3+2
+	for name := range fields {
+		if d := editDistance(key, name); d < bestDist || (d == bestDist && best != "" && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// Levenshtein distance of two strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func (l *pkgLinter) lintFormatVersion(root *yaml.Node, pkgYaml *YamlPkg) {
+	_, versionNode := MappingValue(root, "version")
+	if versionNode == nil {
+		l.report(root, "format `version` is not specified")
+		return
+	}
+	if pkgYaml.FormatVersion < COMPATIBLE_MIN_FORMAT_VERSION {
+		l.report(versionNode, "format version %d is not supported, the min format version is %d", pkgYaml.FormatVersion, COMPATIBLE_MIN_FORMAT_VERSION)
+	} else if pkgYaml.FormatVersion > FORMAT_VERSION {
+		l.report(versionNode, "format version %d is newer than the format version %d supported by pkg %s", pkgYaml.FormatVersion, FORMAT_VERSION, VERSION)
+	}
+}
+
+// lintTemplates checks instructions in `build` and template variables in `build` and `cmake_lib`.
+func (l *pkgLinter) lintTemplates(root *yaml.Node, pkgYaml *YamlPkg) {
+	// args in templates of the package itself must be declared.
+	// For dependencies, the args are declared in their own pkg.yaml files, thus they are not checked.
+	l.args = pkgYaml.Args
+	if l.args == nil {
+		l.args = make(map[string]string)
+	}
+	_, buildNode := MappingValue(root, "build")
+	if buildNode != nil && buildNode.Kind == yaml.MappingNode {
+		for i := 1; i < len(buildNode.Content); i += 2 {
+			l.lintInstructions(buildNode.Content[i])
+		}
+	}
+	if _, cmakeLibNode := MappingValue(root, "cmake_lib"); cmakeLibNode != nil {
+		l.lintTemplateVars(cmakeLibNode)
+	}
+
+	l.args = nil
+
+	// build and cmake_lib of dependencies (including the v1 packages).
+	_, depsNode := MappingValue(root, "dependencies")
+	_, v1PackagesNode := MappingValue(root, "packages")
+	for _, sections := range []*yaml.Node{depsNode, v1PackagesNode} {
+		if sections == nil || sections.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 1; i < len(sections.Content); i += 2 {
+			section := sections.Content[i]
+			if section.Kind != yaml.MappingNode {
+				continue
+			}
+			for j := 1; j < len(section.Content); j += 2 {
+				if _, insNode := MappingValue(section.Content[j], "build"); insNode != nil {
+					l.lintInstructions(insNode)
+				}
+				if _, cmakeLibNode := MappingValue(section.Content[j], "cmake_lib"); cmakeLibNode != nil {
+					l.lintTemplateVars(cmakeLibNode)
+				}
+			}
+		}
+	}
+}
+
+// check instructions in a sequence node.
+func (l *pkgLinter) lintInstructions(seq *yaml.Node) {
+	if seq.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, insNode := range seq.Content {
+		if insNode.Kind == yaml.MappingNode && len(insNode.Content) == 2 && insNode.Content[1].Kind == yaml.MappingNode {
+			// structured form, the instruction is checked while decoding, only check templates in arguments.
+			args := insNode.Content[1]
+			for i := 1; i < len(args.Content); i += 2 {
+				l.lintTemplateVars(args.Content[i])
+			}
+			continue
+		}
+		if insNode.Kind != yaml.ScalarNode {
+			continue
+		}
+		if !l.lintTemplateVars(insNode) {
+			continue
+		}
+		ins, err := ParseIns(insNode.Value)
+		if err != nil {
+			l.report(insNode, "%s", err)
+		} else if !strings.Contains(ins.First, "{{") && !IsValidIns(ins.First) {
+			l.report(insNode, "unknown instruction `%s`, supported instructions: %s", ins.First, strings.Join(Instructions, ", "))
+		}
+	}
+}
+
+// lintTemplateVars checks the template syntax of a scalar node and the variables used in the template.
+// It returns false if the template can not be parsed.
+func (l *pkgLinter) lintTemplateVars(node *yaml.Node) bool {
+	if node.Kind != yaml.ScalarNode {
+		return true
+	}
+	tmpl, err := template.New("o").Funcs(TemplateFuncs(nil)).Parse(node.Value)
+	if err != nil {
+		l.report(node, "template syntax error: %s", strings.TrimPrefix(err.Error(), "template: "))
+		return false
+	}
+	if tmpl.Tree == nil {
+		return true
+	}
+
+	known := make(map[string]bool)
+	for _, name := range TemplateVarNames() {
+		known[name] = true
+	}
+	for _, field := range templateFields(tmpl.Tree.Root) {
+		if !known[field.Ident[0]] {
+			l.report(node, "undefined variable `.%s` in template", strings.Join(field.Ident, "."))
+		} else if field.Ident[0] == argsVarName && l.args != nil && len(field.Ident) > 1 {
+			if _, ok := l.args[field.Ident[1]]; !ok {
+				l.report(node, "arg `%s` used in template is not declared in `args`", field.Ident[1])
+			}
+		}
+	}
+	return true
+}
+
+// templateFields collects field nodes (e.g. `.CACHE`) referring to the top level data in a template.
+// Fields inside `range` and `with` are skipped, because the data (dot) is changed there.
+func templateFields(node parse.Node) []*parse.FieldNode {
+	var fields []*parse.FieldNode
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			fields = append(fields, n)
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+		case *parse.WithNode:
+			walk(n.Pipe)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+	walk(node)
+	return fields
+}
+
+// lintFeatures checks the packages and features referred by features.
+func (l *pkgLinter) lintFeatures(root *yaml.Node, pkgYaml *YamlPkg) {
+	_, featuresNode := MappingValue(root, "features")
+	if featuresNode == nil || featuresNode.Kind != yaml.MappingNode {
+		return
+	}
+
+	// package names of all declared dependencies.
+	declared := make(map[string]bool)
+	for key := range pkgYaml.Deps.GitPackages {
+		declared[depKeyPackageName(key)] = true
+	}
+	for key := range pkgYaml.Deps.FilesPackages {
+		declared[key] = true
+	}
+	for key := range pkgYaml.Deps.ArchivePackages {
+		declared[key] = true
+	}
+	for key := range pkgYaml.Packages.GitPackages {
+		declared[key] = true
+	}
+	for key := range pkgYaml.Packages.FilesPackages {
+		declared[key] = true
+	}
+
+	for i := 0; i+1 < len(featuresNode.Content); i += 2 {
+		featName, featNode := featuresNode.Content[i].Value, featuresNode.Content[i+1]
+		if _, depsNode := MappingValue(featNode, "deps"); depsNode != nil && depsNode.Kind == yaml.SequenceNode {
+			for _, dep := range depsNode.Content {
+				if !declared[dep.Value] {
+					l.report(dep, "package `%s` used by feature `%s` is not declared in dependencies", dep.Value, featName)
+				}
+			}
+		}
+		if _, needsNode := MappingValue(featNode, "needs"); needsNode != nil && needsNode.Kind == yaml.SequenceNode {
+			for _, need := range needsNode.Content {
+				if _, ok := pkgYaml.Features[need.Value]; !ok {
+					l.report(need, "feature `%s` needed by feature `%s` is not declared", need.Value, featName)
+				}
+			}
+		}
+	}
+}
+
+// lintConditions checks the `when` conditions of dependencies and features.
+func (l *pkgLinter) lintConditions(root *yaml.Node) {
+	var whenNodes []*yaml.Node
+	if _, featuresNode := MappingValue(root, "features"); featuresNode != nil && featuresNode.Kind == yaml.MappingNode {
+		for i := 1; i < len(featuresNode.Content); i += 2 {
+			if _, whenNode := MappingValue(featuresNode.Content[i], "when"); whenNode != nil {
+				whenNodes = append(whenNodes, whenNode)
+			}
+		}
+	}
+	_, depsNode := MappingValue(root, "dependencies")
+	for _, section := range []string{DepsSectionGit, DepsSectionFiles, DepsSectionArchive} {
+		if _, secNode := MappingValue(depsNode, section); secNode != nil && secNode.Kind == yaml.MappingNode {
+			for i := 1; i < len(secNode.Content); i += 2 {
+				if _, whenNode := MappingValue(secNode.Content[i], "when"); whenNode != nil {
+					whenNodes = append(whenNodes, whenNode)
+				}
+			}
+		}
+	}
+
+	for _, whenNode := range whenNodes {
+		var cond YamlCondition
+		if err := whenNode.Decode(&cond); err != nil {
+			continue // already reported in type checking.
+		}
+		if _, err := cond.Match(CurrentPlatform()); err != nil {
+			_, exprNode := MappingValue(whenNode, "expr")
+			if exprNode == nil {
+				exprNode = whenNode
+			}
+			l.report(exprNode, "%s", err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintPkgYaml(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    int
+		message string // substring of the message, empty for no errors.
+	}{
+		{"valid", `version: 3
+dependencies:
+  packages:
+    github.com/foo/bar@v1.0.0:
+      build:
+        - CMAKE {{.CACHE}} -DBAR_DIR={{pkgdir "github.com/foo/bar"}} -DV={{.VERSION | replace "." "_"}}
+features:
+  a:
+    deps: [github.com/foo/bar]
+`, 0, ""},
+		{"unknown field", `version: 3
+dependencies:
+  packages:
+    github.com/foo/bar@v1.0.0:
+      bulid: []
+`, 5, "did you mean `build`"},
+		{"bad type", `version: 3
+dependencies:
+  packages:
+    github.com/foo/bar:
+      optional: yes-please
+`, 5, "optional"},
+		{"newer format version", "version: 99\n", 1, "newer"},
+		{"undefined template var", `version: 3
+build:
+  self:
+    - CMAKE {{.NO_SUCH_VAR}}
+`, 4, "NO_SUCH_VAR"},
+		{"unknown instruction", `version: 3
+build:
+  self:
+    - COPY a b
+`, 4, "unknown instruction `COPY`"},
+		{"structured instruction", `version: 3
+build:
+  self:
+    - run: {dir: "{{.CACHE}}", cmd: make && make install}
+    - cmake: {config: -DFOO=ON}
+`, 0, ""},
+		{"structured instruction unknown argument", `version: 3
+build:
+  self:
+    - run: {dir: "{{.CACHE}}", command: make}
+`, 4, "unknown argument `command`"},
+		{"structured instruction undefined var", `version: 3
+build:
+  self:
+    - run: {dir: "{{.NO_SUCH_DIR}}", cmd: make}
+`, 4, "NO_SUCH_DIR"},
+		{"unterminated quote", `version: 3
+build:
+  self:
+    - CP "a b.h {{.INCLUDE}}
+`, 4, "unterminated"},
+		{"undeclared feature dep", `version: 3
+features:
+  a:
+    deps: [github.com/foo/bar]
+    needs: [b]
+`, 4, "not declared in dependencies"},
+		{"undeclared arg", `version: 3
+args:
+  BLAS: openblas
+build:
+  self:
+    - CMAKE -DBLAS={{.args.BLAS}} -DLAPACK={{.args.LAPACK}}
+`, 6, "arg `LAPACK`"},
+		{"bad condition expression", `version: 3
+dependencies:
+  packages:
+    github.com/foo/bar@v1.0.0:
+      when: {os: [linux], expr: 'eq .CPU "x86"'}
+`, 5, "bad condition expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := LintPkgYaml([]byte(tt.content))
+			if tt.message == "" {
+				if len(errs) != 0 {
+					t.Fatalf("expect no errors, but got %v", errs)
+				}
+				return
+			}
+			if len(errs) == 0 {
+				t.Fatalf("expect error containing %q, but got none", tt.message)
+			}
+			if errs[0].Line != tt.line || !strings.Contains(errs[0].Message, tt.message) {
+				t.Errorf("expect error at line %d containing %q, but got %v", tt.line, tt.message, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// InstallManifest records files installed by a package in a build config.
+// Files are paths relative to the vendor directory in slash form, e.g. pkg/fmt/include/fmt/core.h, include/foo.h.
+type InstallManifest struct {
+	Package string   `json:"package"`
+	Version string   `json:"version"`
+	Config  string   `json:"config"`
+	Files   []string `json:"files"`
+}
+
+// LoadManifest reads the install manifest from a json file.
+func LoadManifest(path string) (*InstallManifest, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest InstallManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// Save writes the manifest to a json file, files are sorted.
+func (m *InstallManifest) Save(path string) error {
+	sort.Strings(m.Files)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// LoadManifests reads all install manifests under @base/vendor/manifests.
+func LoadManifests(base string) ([]InstallManifest, error) {
+	var manifests []InstallManifest
+	dir := filepath.Join(base, VendorName, VendorManifests)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		if manifest, err := LoadManifest(path); err != nil {
+			return err
+		} else {
+			manifests = append(manifests, *manifest)
+		}
+		return nil
+	})
+	return manifests, err
+}
+
+// RemoveFiles removes the files in the manifest from @base/vendor, except files for which keep returns true.
+// Empty parent directories of removed files are also removed (directories directly under vendor are kept).
+// It returns the number of removed files.
+func (m *InstallManifest) RemoveFiles(base string, keep func(file string) bool) (int, error) {
+	vendor := GetVendorPath(base)
+	removed := 0
+	for _, file := range m.Files {
+		if keep != nil && keep(file) {
+			continue
+		}
+		path := filepath.Join(vendor, filepath.FromSlash(file))
+		if rel, err := filepath.Rel(vendor, path); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue // never remove files out of vendor.
+		}
+		if err := os.Remove(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return removed, err
+		}
+		removed++
+		for dir := filepath.Dir(path); filepath.Dir(dir) != vendor && dir != vendor; dir = filepath.Dir(dir) {
+			if err := os.Remove(dir); err != nil {
+				break // not empty
+			}
+		}
+	}
+	return removed, nil
+}
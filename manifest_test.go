@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallManifest(t *testing.T) {
+	base := t.TempDir()
+	files := []string{"pkg/foo/lib/libfoo.a", "pkg/foo/include/foo/foo.h", "include/foo.h", "include/shared.h"}
+	for _, file := range files {
+		path := filepath.Join(GetVendorPath(base), filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest := InstallManifest{Package: "foo", Version: "v1", Config: "Release", Files: append(files, "../outside.h")}
+	if err := manifest.Save(GetManifestPath(base, "Release", "foo")); err != nil {
+		t.Fatal(err)
+	}
+	if manifests, err := LoadManifests(base); err != nil || len(manifests) != 1 || manifests[0].Package != "foo" || len(manifests[0].Files) != 5 {
+		t.Fatalf("unexpected manifests: %v, %v", manifests, err)
+	}
+
+	removed, err := manifest.RemoveFiles(base, func(file string) bool { return file == "include/shared.h" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Errorf("expect 3 files removed, but got %d", removed)
+	}
+	if _, err := os.Stat(filepath.Join(GetVendorPath(base), "include", "shared.h")); err != nil {
+		t.Errorf("expect kept file exists, but got %v", err)
+	}
+	// empty package directory is removed, but vendor/pkg is kept.
+	if _, err := os.Stat(GetPackagePkgPath(base, "foo")); !os.IsNotExist(err) {
+		t.Errorf("expect empty package directory removed, but got %v", err)
+	}
+	if _, err := os.Stat(GetPkgPath(base)); err != nil {
+		t.Errorf("expect vendor/pkg kept, but got %v", err)
+	}
+}
@@ -61,5 +61,9 @@ func (c *clean) Run() error {
 			log.Info("clean cache directory `", cachePath, "` successfully")
 		}
 	}
+	// remove build stamps, thus all packages will be built again in next installation.
+	if err := os.RemoveAll(filepath.Join(c.home, pkg.VendorName, pkg.VendorStamps)); err != nil {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,131 @@
+package edit
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/genshen/cmds"
+	"github.com/genshen/pkg"
+	"github.com/genshen/pkg/conf"
+	"github.com/genshen/pkg/pkg/fetch"
+	log "github.com/sirupsen/logrus"
+)
+
+var addCommand = &cmds.Command{
+	Name:        "add",
+	Summary:     "add a git dependency package to " + pkg.PkgFileName,
+	Description: "add a git dependency package to " + pkg.PkgFileName + " and fetch it, e.g. `pkg add github.com/fmtlib/fmt@10.2.1 -target fmt`.",
+	CustomFlags: false,
+	HasOptions:  true,
+}
+
+func init() {
+	var pwd string
+	var err error
+	if pwd, err = os.Getwd(); err != nil {
+		pwd = "./"
+	}
+
+	var a add
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	addCommand.FlagSet = fs
+	a.setFlags(fs, pwd)
+	addCommand.FlagSet.StringVar(&a.target, "target", "", "cmake package name (target) of the package")
+	addCommand.FlagSet.StringVar(&a.path, "path", "", "git repository url of the package, default is https://{package}.git")
+	addCommand.FlagSet.StringVar(&a.pkgFeatures, "pkg-features", "", "Comma separated list of cmake options of the package. e.g. --pkg-features=FMT_TEST=OFF")
+	addCommand.FlagSet.BoolVar(&a.optional, "optional", false, "add the package as an optional package")
+	addCommand.FlagSet.Usage = addCommand.Usage // use default usage provided by cmds.Command.
+	addCommand.Runner = &a
+	cmds.AllCommands = append(cmds.AllCommands, addCommand)
+}
+
+type add struct {
+	editOptions
+	target      string
+	path        string
+	pkgFeatures string
+	optional    bool
+	packageName string
+	version     string
+}
+
+func (a *add) PreRun() error {
+	if err := a.check(); err != nil {
+		return err
+	}
+	arg, err := parsePositionalArg(addCommand.FlagSet)
+	if err != nil {
+		return err
+	}
+	keySplit := strings.SplitN(arg, "@", 2)
+	a.packageName = keySplit[0]
+	if len(keySplit) == 2 {
+		a.version = keySplit[1]
+	}
+	if a.packageName == "" {
+		return errors.New("package name is empty")
+	}
+	return nil
+}
+
+func (a *add) Run() error {
+	doc, err := pkg.LoadPkgYamlDoc(a.pkgFilePath())
+	if err != nil {
+		return err
+	}
+
+	// use the latest tag if version is not specified.
+	if a.version == "" {
+		if version, err := a.latestVersion(doc); err != nil {
+			return err
+		} else {
+			a.version = version
+			log.WithFields(log.Fields{"pkg": a.packageName, "version": version}).Info("use the latest version.")
+		}
+	}
+
+	pairs := []interface{}{"version", a.version}
+	if a.target != "" {
+		pairs = append(pairs, "target", a.target)
+	}
+	if a.path != "" {
+		pairs = append(pairs, "path", a.path)
+	}
+	if a.pkgFeatures != "" {
+		pairs = append(pairs, "features", strings.Split(a.pkgFeatures, ","))
+	}
+	if a.optional {
+		pairs = append(pairs, "optional", true)
+	}
+	value, err := pkg.NewFlowMapping(pairs...)
+	if err != nil {
+		return err
+	}
+	if err := doc.AddDependency(pkg.DepsSectionGit, a.packageName, value); err != nil {
+		return err
+	}
+	return a.saveAndFetch(doc, nil)
+}
+
+// find the latest version tag of the package in its remote repository.
+func (a *add) latestVersion(doc *pkg.PkgYamlDoc) (string, error) {
+	pkgYaml, err := doc.Decode()
+	if err != nil {
+		return "", err
+	}
+	config, err := conf.ParseConfig(a.home)
+	if err != nil {
+		return "", err
+	}
+	tags, err := fetch.ListGitTags(config.Auth, fetch.GitRemoteUrl(a.path, a.packageName, pkgYaml.GitReplace, config.GitReplace))
+	if err != nil {
+		return "", err
+	}
+	if _, latest := fetch.LatestVersions("", tags); latest != "" {
+		return latest, nil
+	}
+	return "", fmt.Errorf("no version tag is found for package %s, please specify the version by %s@{version}", a.packageName, a.packageName)
+}
@@ -0,0 +1,82 @@
+package edit
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/genshen/pkg"
+	"github.com/genshen/pkg/pkg/fetch"
+	log "github.com/sirupsen/logrus"
+)
+
+// options shared by commands editing pkg.yaml.
+type editOptions struct {
+	home     string
+	features string // features used in fetching, empty for the features of the last fetching
+	noFetch  bool   // only edit pkg.yaml, skip fetching
+}
+
+func (e *editOptions) setFlags(fs *flag.FlagSet, pwd string) {
+	fs.StringVar(&e.home, "home", pwd, "path of home directory (where is "+pkg.PkgFileName+" file located)")
+	fs.StringVar(&e.features, "features", "", "Comma separated list of features to activate while fetching. e.g. --features=foo,bar. Features of the last fetching are used if it is not specified.")
+	fs.BoolVar(&e.noFetch, "no-fetch", false, "only edit "+pkg.PkgFileName+", do not fetch packages")
+}
+
+func (e *editOptions) pkgFilePath() string {
+	return filepath.Join(e.home, pkg.PkgFileName)
+}
+
+func (e *editOptions) check() error {
+	if e.home == "" {
+		return errors.New("flag home is required")
+	}
+	// check pkg.yaml file existence.
+	if fileInfo, err := os.Stat(e.pkgFilePath()); err != nil {
+		return err
+	} else if fileInfo.IsDir() {
+		return fmt.Errorf("%s is not a file", pkg.PkgFileName)
+	}
+	return nil
+}
+
+// save the edited pkg.yaml, and then fetch packages.
+// refresh: packages to be downloaded again.
+func (e *editOptions) saveAndFetch(doc *pkg.PkgYamlDoc, refresh []string) error {
+	// make sure the edited file is still a valid pkg.yaml file.
+	if _, err := doc.Decode(); err != nil {
+		return err
+	}
+	if err := doc.Save(e.pkgFilePath()); err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"file": e.pkgFilePath()}).Info("saved package file.")
+
+	if e.noFetch {
+		return nil
+	}
+	var features []string
+	if e.features != "" {
+		features = strings.Split(e.features, ",")
+	}
+	return fetch.FetchPackages(e.home, features, refresh)
+}
+
+// parsePositionalArg returns the first positional argument and parses the flags after it,
+// thus both `pkg add foo -target bar` and `pkg add -target bar foo` are supported.
+func parsePositionalArg(fs *flag.FlagSet) (string, error) {
+	if fs.NArg() == 0 {
+		return "", errors.New("package is not specified")
+	}
+	arg := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 0 {
+		return "", fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return arg, nil
+}
@@ -0,0 +1,75 @@
+package edit
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/genshen/cmds"
+	"github.com/genshen/pkg"
+	log "github.com/sirupsen/logrus"
+)
+
+var removeCommand = &cmds.Command{
+	Name:        "remove",
+	Summary:     "remove a dependency package from " + pkg.PkgFileName,
+	Description: "remove a dependency package from " + pkg.PkgFileName + " and update fetched packages, e.g. `pkg remove github.com/fmtlib/fmt`.",
+	CustomFlags: false,
+	HasOptions:  true,
+}
+
+func init() {
+	var pwd string
+	var err error
+	if pwd, err = os.Getwd(); err != nil {
+		pwd = "./"
+	}
+
+	var r remove
+	fs := flag.NewFlagSet("remove", flag.ExitOnError)
+	removeCommand.FlagSet = fs
+	r.setFlags(fs, pwd)
+	removeCommand.FlagSet.Usage = removeCommand.Usage // use default usage provided by cmds.Command.
+	removeCommand.Runner = &r
+	cmds.AllCommands = append(cmds.AllCommands, removeCommand)
+}
+
+type remove struct {
+	editOptions
+	packageName string
+}
+
+func (r *remove) PreRun() error {
+	if err := r.check(); err != nil {
+		return err
+	}
+	if arg, err := parsePositionalArg(removeCommand.FlagSet); err != nil {
+		return err
+	} else {
+		r.packageName = arg
+	}
+	return nil
+}
+
+func (r *remove) Run() error {
+	doc, err := pkg.LoadPkgYamlDoc(r.pkgFilePath())
+	if err != nil {
+		return err
+	}
+	if !doc.RemoveDependency(r.packageName) {
+		return fmt.Errorf("package %s is not found in dependencies", r.packageName)
+	}
+
+	// warn features still referring to the removed package.
+	if pkgYaml, err := doc.Decode(); err == nil {
+		for featName, feat := range pkgYaml.Features {
+			for _, dep := range feat.Deps {
+				if dep == r.packageName {
+					log.WithFields(log.Fields{"pkg": r.packageName, "feature": featName}).
+						Warning("the removed package is still used by feature.")
+				}
+			}
+		}
+	}
+	return r.saveAndFetch(doc, nil)
+}
@@ -0,0 +1,119 @@
+package edit
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/genshen/cmds"
+	"github.com/genshen/pkg"
+	"github.com/genshen/pkg/conf"
+	"github.com/genshen/pkg/pkg/fetch"
+	log "github.com/sirupsen/logrus"
+)
+
+var updateCommand = &cmds.Command{
+	Name:    "update",
+	Summary: "update version of a dependency package in " + pkg.PkgFileName,
+	Description: "update version of a git dependency package in " + pkg.PkgFileName + " and fetch it, e.g. `pkg update github.com/fmtlib/fmt@10.2.1`.\n" +
+		"If version is not specified, the latest compatible version tag is used. " +
+		"If there is no compatible version tag (e.g. the version is a branch), the package is downloaded again.",
+	CustomFlags: false,
+	HasOptions:  true,
+}
+
+func init() {
+	var pwd string
+	var err error
+	if pwd, err = os.Getwd(); err != nil {
+		pwd = "./"
+	}
+
+	var u update
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	updateCommand.FlagSet = fs
+	u.setFlags(fs, pwd)
+	updateCommand.FlagSet.Usage = updateCommand.Usage // use default usage provided by cmds.Command.
+	updateCommand.Runner = &u
+	cmds.AllCommands = append(cmds.AllCommands, updateCommand)
+}
+
+type update struct {
+	editOptions
+	packageName string
+	version     string
+}
+
+func (u *update) PreRun() error {
+	if err := u.check(); err != nil {
+		return err
+	}
+	arg, err := parsePositionalArg(updateCommand.FlagSet)
+	if err != nil {
+		return err
+	}
+	keySplit := strings.SplitN(arg, "@", 2)
+	u.packageName = keySplit[0]
+	if len(keySplit) == 2 {
+		u.version = keySplit[1]
+	}
+	return nil
+}
+
+func (u *update) Run() error {
+	doc, err := pkg.LoadPkgYamlDoc(u.pkgFilePath())
+	if err != nil {
+		return err
+	}
+
+	var refresh []string
+	if u.version == "" {
+		if version, err := u.compatibleVersion(doc); err != nil {
+			return err
+		} else if version != "" {
+			u.version = version
+		} else {
+			// download it again, e.g. a branch.
+			refresh = append(refresh, u.packageName)
+			log.WithFields(log.Fields{"pkg": u.packageName}).Info("no newer compatible version found, the package will be downloaded again.")
+		}
+	}
+	if u.version != "" {
+		log.WithFields(log.Fields{"pkg": u.packageName, "version": u.version}).Info("update package version.")
+		if err := doc.SetDependencyVersion(u.packageName, u.version); err != nil {
+			return err
+		}
+	}
+	return u.saveAndFetch(doc, refresh)
+}
+
+// compatibleVersion returns the latest compatible version newer than the current version.
+// Empty string is returned if no such version.
+func (u *update) compatibleVersion(doc *pkg.PkgYamlDoc) (string, error) {
+	pkgYaml, err := doc.Decode()
+	if err != nil {
+		return "", err
+	}
+	_, key, _ := doc.FindDependency(u.packageName)
+	gitPkg, ok := pkgYaml.Deps.GitPackages[key]
+	if !ok {
+		return "", nil // not a git package (or not found), SetDependencyVersion reports the error.
+	}
+	meta := pkg.PackageMeta{Version: gitPkg.Version}
+	if err := meta.SetPackageName(key); err != nil {
+		return "", err
+	}
+
+	config, err := conf.ParseConfig(u.home)
+	if err != nil {
+		return "", err
+	}
+	tags, err := fetch.ListGitTags(config.Auth, fetch.GitRemoteUrl(gitPkg.Path, meta.PackageName, pkgYaml.GitReplace, config.GitReplace))
+	if err != nil {
+		return "", err
+	}
+	if compatible, _ := fetch.LatestVersions(meta.Version, tags); fetch.IsNewerVersion(meta.Version, compatible) {
+		return compatible, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,104 @@
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/genshen/cmds"
+	"github.com/genshen/pkg"
+)
+
+const (
+	ShellBash = "bash"
+	ShellFish = "fish"
+	ShellJson = "json"
+)
+
+var envCommand = &cmds.Command{
+	Name:    "env",
+	Summary: "print environment variables for using installed packages",
+	Description: "print PATH, LD_LIBRARY_PATH, PKG_CONFIG_PATH, CMAKE_PREFIX_PATH, CPATH and LIBRARY_PATH " +
+		"covering all installed packages, usage: eval \"$(pkg env)\"",
+	CustomFlags: false,
+	HasOptions:  true,
+}
+
+func init() {
+	var pwd string
+	var err error
+	if pwd, err = os.Getwd(); err != nil {
+		pwd = "./"
+	}
+
+	var e env
+	fs := flag.NewFlagSet("env", flag.ExitOnError)
+	envCommand.FlagSet = fs
+	envCommand.FlagSet.StringVar(&e.home, "home", pwd, "path of home directory (where is "+pkg.PkgFileName+" file located)")
+	envCommand.FlagSet.StringVar(&e.config, "config", pkg.DefaultBuildType, "build config of the installed packages, e.g. Release, Debug, or <profile>-<build type>.")
+	envCommand.FlagSet.StringVar(&e.shell, "shell", ShellBash, "output format: bash (also for sh and zsh), fish or json.")
+	envCommand.FlagSet.Usage = envCommand.Usage // use default usage provided by cmds.Command.
+	envCommand.Runner = &e
+	cmds.AllCommands = append(cmds.AllCommands, envCommand)
+}
+
+type env struct {
+	home   string
+	config string
+	shell  string
+}
+
+func (e *env) PreRun() error {
+	if e.home == "" {
+		return errors.New("flag home is required")
+	}
+	if e.shell != ShellBash && e.shell != ShellFish && e.shell != ShellJson {
+		return fmt.Errorf("unsupported shell `%s`", e.shell)
+	}
+	return nil
+}
+
+func (e *env) Run() error {
+	vars, err := pkg.LoadInstalledEnv(e.home, e.config)
+	if err != nil {
+		return err
+	}
+	return writeEnv(os.Stdout, e.shell, vars)
+}
+
+// writeEnv writes the variables as shell script (paths are prepended to the existing values), or json.
+func writeEnv(w io.Writer, shell string, vars []pkg.InstalledEnvVar) error {
+	if shell == ShellJson {
+		paths := make(map[string][]string)
+		for _, v := range vars {
+			paths[v.Name] = v.Paths
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(paths)
+	}
+	for _, v := range vars {
+		if len(v.Paths) == 0 {
+			continue
+		}
+		var line string
+		if shell == ShellFish {
+			quoted := make([]string, 0, len(v.Paths))
+			for _, path := range v.Paths {
+				quoted = append(quoted, "'"+strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(path)+"'")
+			}
+			line = fmt.Sprintf("set -gx %s %s $%s\n", v.Name, strings.Join(quoted, " "), v.Name)
+		} else {
+			value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`").Replace(strings.Join(v.Paths, ":"))
+			line = fmt.Sprintf("export %s=\"%s${%s:+:$%s}\"\n", v.Name, value, v.Name, v.Name)
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -43,6 +43,30 @@ set(VENDOR_PATH $ENV{PKG_VENDOR_PATH})
 {{end}}
 set(PROJECT_HOME_PATH {{.ProjectHomePath}})
 
+# install prefix of packages in vendor, selected by CMAKE_BUILD_TYPE and PKG_PROFILE (toolchain profile):
+# "pkg" for Release build, "pkg-<build type in lower case>" for others (e.g. pkg-debug),
+# and "pkg-<profile>-<build type in lower case>" if PKG_PROFILE is set (by cmake option or environment variable).
+# If packages are not installed for the build type (by "pkg install -build-type"), "pkg" is used.
+if(NOT DEFINED PKG_PROFILE)
+    set(PKG_PROFILE $ENV{PKG_PROFILE})
+endif()
+if(NOT DEFINED PKG_PREFIX_DIR)
+    set(PKG_PREFIX_DIR pkg)
+    set(PKG_BUILD_CONFIG "${CMAKE_BUILD_TYPE}")
+    if(PKG_PROFILE)
+        if(NOT CMAKE_BUILD_TYPE)
+            set(PKG_BUILD_CONFIG "Release")
+        endif()
+        set(PKG_BUILD_CONFIG "${PKG_PROFILE}-${PKG_BUILD_CONFIG}")
+    endif()
+    if(PKG_BUILD_CONFIG AND NOT PKG_BUILD_CONFIG STREQUAL "Release")
+        string(TOLOWER "pkg-${PKG_BUILD_CONFIG}" PKG_BUILD_CONFIG_PREFIX_DIR)
+        if(EXISTS ${VENDOR_PATH}/${PKG_BUILD_CONFIG_PREFIX_DIR})
+            set(PKG_PREFIX_DIR ${PKG_BUILD_CONFIG_PREFIX_DIR})
+        endif()
+    endif()
+endif()
+
 include_directories(${VENDOR_PATH}/include)
 `
 
@@ -153,11 +177,20 @@ func cmakeLib(depTree *pkg.DependencyTree, pkgHome string, findPackageOptions st
 		return err
 	}
 
+	// metadata of all dependencies, used for referring other packages in templates.
+	metas := make(map[string]pkg.PackageMeta)
+	for _, dep := range depsList {
+		metas[dep.Context.PackageName] = dep.Context
+	}
+
 	basePath := "${PROJECT_HOME_PATH}"
 	for _, dep := range depsList {
 		src := dep.Context.VendorSrcPath(basePath) // vendor/src/@pkg@version,using relative path.
 		// add env variables for this package, using relative path.
 		packageEnv := pkg.NewPackageEnvs(basePath, dep.Context.PackageName, src)
+		packageEnv.SetCMakeBuildConfig()
+		packageEnv.SetPackageMeta(&dep.Context)
+		packageEnv.Metas = metas
 		// generating cmake script.
 		toFile := cmakeDepData{
 			PackageMeta: pkg.PackageMeta{
@@ -170,7 +203,7 @@ func cmakeLib(depTree *pkg.DependencyTree, pkgHome string, findPackageOptions st
 			},
 			SrcDir:             src,
 			DepsDir:            pkg.GetPackageDepsPath(basePath, dep.Context.PackageName),
-			PkgDir:             pkg.GetPackagePkgPath(basePath, dep.Context.PackageName),
+			PkgDir:             pkg.GetCMakePackagePkgPath(basePath, dep.Context.PackageName),
 			FindPackageOptions: findPackageOptions,
 		}
 		// copy slice, don't modify the original data.
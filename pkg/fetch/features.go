@@ -33,16 +33,17 @@ func checkOptionalPackageFeatureMatches(context pkg.PackageMeta, featPkgList []s
 // First, it filters all active features in all available features,
 // then the active packages in each active features is selected.
 // Please note, active features is specified by cli flags.
-func activeFeatureOptionalPackages(allFeatures map[string]pkg.YamlFeatures, activeFeatures []string) (error, []string) {
+// Features whose `when` condition does not match the target platform are not activated.
+func activeFeatureOptionalPackages(allFeatures map[string]pkg.YamlFeatures, activeFeatures []string, platform pkg.Platform) (error, []string) {
 	featVisitMap := make(map[string]bool)
-	if err, activePackages := dfsSearchAllFeaturePackages(allFeatures, featVisitMap, activeFeatures); err != nil {
+	if err, activePackages := dfsSearchAllFeaturePackages(allFeatures, featVisitMap, activeFeatures, platform); err != nil {
 		return err, nil
 	} else {
 		return nil, activePackages
 	}
 }
 
-func dfsSearchAllFeaturePackages(allFeatures map[string]pkg.YamlFeatures, featVisitMap map[string]bool, activeFeatures []string) (error, []string) {
+func dfsSearchAllFeaturePackages(allFeatures map[string]pkg.YamlFeatures, featVisitMap map[string]bool, activeFeatures []string, platform pkg.Platform) (error, []string) {
 	if allFeatures == nil {
 		return nil, nil
 	}
@@ -60,9 +61,15 @@ func dfsSearchAllFeaturePackages(allFeatures map[string]pkg.YamlFeatures, featVi
 			// if this feature is not added before, add it.
 			if _, ok2 := featVisitMap[featName]; !ok2 {
 				featVisitMap[featName] = true
+				if matched, err := feat.When.Match(platform); err != nil {
+					return fmt.Errorf("feature %s: %w", featName, err), nil
+				} else if !matched {
+					log.Printf("feature %s is skipped, because its condition does not match the target platform %s/%s", featName, platform.OS, platform.Arch)
+					continue
+				}
 				// append packages in current level.
 				localActivePackages = append(localActivePackages, feat.Deps...)
-				if err, pkgList := dfsSearchAllFeaturePackages(allFeatures, featVisitMap, feat.Needs); err != nil {
+				if err, pkgList := dfsSearchAllFeaturePackages(allFeatures, featVisitMap, feat.Needs, platform); err != nil {
 					return err, nil
 				} else {
 					// append packages in deeper level.
@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"syscall"
 	"text/template"
 
 	"github.com/AlecAivazis/survey/v2"
@@ -45,6 +48,9 @@ func init() {
 	fetchCommand.FlagSet.StringVar(&f.CMakeFindPackageOption, "cmake-find-package-arg", "NO_DEFAULT_PATH", "global options for find_package when generating file pkg.dep.cmake")
 	fetchCommand.FlagSet.StringVar(&f.FeaturesOption, "features", DefaultFeatureName, "Comma separated list of features to activate. e.g. --features=foo,bar")
 	fetchCommand.FlagSet.BoolVar(&f.NoCache, "no-cache", false, "Don't use the system cache. Directly download from the Internet")
+	fetchCommand.FlagSet.Var(&f.ArgsOption, "arg", "override value of an arg declared in "+pkg.PkgFileName+", format: KEY=VALUE. It can be used multiple times.")
+	fetchCommand.FlagSet.StringVar(&f.Platform.OS, "target-os", runtime.GOOS, "target os for evaluating `when` conditions of packages and features, and .OS in instructions (e.g. linux, darwin)")
+	fetchCommand.FlagSet.StringVar(&f.Platform.Arch, "target-arch", runtime.GOARCH, "target arch for evaluating `when` conditions of packages and features, and .ARCH in instructions (e.g. amd64, arm64)")
 	// todo make pkgHome abs path anyway.
 	fetchCommand.FlagSet.Usage = fetchCommand.Usage // use default usage provided by cmds.Command.
 	fetchCommand.Runner = &f
@@ -52,12 +58,16 @@ func init() {
 }
 
 type fetch struct {
-	PkgHome                string   // the absolute path of root 'pkg.yaml' form command path.
-	CMakeFindPackageOption string   // global find_package option, default is "NO_DEFAULT_PATH".
-	FeaturesOption         string   // cli `feature` string
-	FeatureList            []string // feature list parsed from cli option.
-	MirrorConfPath         string   // the file path of repo mirror file.
-	NoCache                bool     // download package without using global cache
+	PkgHome                string            // the absolute path of root 'pkg.yaml' form command path.
+	CMakeFindPackageOption string            // global find_package option, default is "NO_DEFAULT_PATH".
+	FeaturesOption         string            // cli `feature` string
+	FeatureList            []string          // feature list parsed from cli option.
+	MirrorConfPath         string            // the file path of repo mirror file.
+	NoCache                bool              // download package without using global cache
+	Refresh                []string          // packages to be downloaded again from remote, even if they exist in vendor or global cache.
+	Platform               pkg.Platform      // target platform for evaluating conditions of packages and features.
+	ArgsOption             pkg.ArgValues     // args from cli, which override args in config file.
+	ConfigArgs             map[string]string // args from config file.
 	DepTree                pkg.DependencyTree
 	Auth                   map[string]conf.Auth
 	GlobalReplace          map[string]string
@@ -88,6 +98,7 @@ func (f *fetch) PreRun() error {
 	} else {
 		f.Auth = config.Auth
 		f.GlobalReplace = config.GitReplace
+		f.ConfigArgs = config.Args
 	}
 
 	// parse feature list
@@ -107,12 +118,32 @@ func (f *fetch) Run() error {
 	if err != nil {
 		return err
 	}
+	// remove temp download directories on SIGINT/SIGTERM, and at the end (directories left by failed downloads).
+	defer pkg.RemoveSrcDlTempPaths()
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(sigs)
+		close(done)
+	}()
+	go func() {
+		select {
+		case sig := <-sigs:
+			log.WithFields(log.Fields{"signal": sig}).Warning("fetching is canceled, temporary download directories are removed.")
+			pkg.RemoveSrcDlTempPaths()
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+
 	// fetch packages to user home directory.
 	log.Info("packages will be downloaded to directory ", pkgSrcDir)
 	pkgLock := make(map[string]string)
 	if err := f.fetchSubDependency(pkg.RootPKG, f.PkgHome, f.FeatureList, &pkgLock, &f.DepTree); err != nil {
 		return err
 	}
+	f.warnUnusedArgs()
 
 	// process package conflict
 	packageConflict := func(packageName string, packs pkg.PackageMetas) (pkg.PackageMeta, error) {
@@ -176,7 +207,9 @@ func (f *fetch) Run() error {
 		return err
 	} else {
 		defer file.Close()
-		if err := f.DepTree.MarshalGraph(file); err != nil {
+		if graph, err := f.DepTree.Graph(); err != nil {
+			return err
+		} else if err := graph.WriteJson(file); err != nil {
 			return err
 		}
 	}
@@ -192,6 +225,67 @@ func (f *fetch) Run() error {
 	return nil
 }
 
+// FetchPackages fetches dependency packages of the project located at pkgHome,
+// and then generates the sum file, the graph file and cmake files, which is the same as `pkg fetch`.
+// Packages already in vendor directory are not downloaded again, except packages listed in refresh.
+// The features (if features is nil), args from cli and the target platform of the last fetching
+// recorded in the sum file are kept.
+func FetchPackages(pkgHome string, features []string, refresh []string) error {
+	f := fetch{
+		PkgHome:                pkgHome,
+		CMakeFindPackageOption: "NO_DEFAULT_PATH",
+		Refresh:                refresh,
+		Platform:               pkg.CurrentPlatform(),
+	}
+	var metas map[string]pkg.PackageMeta
+	if err := pkg.DepTreeRecover(&metas, pkg.GetPkgSumPath(pkgHome)); err == nil {
+		if root, ok := metas[pkg.RootPKG]; ok {
+			if features == nil {
+				features = root.Features
+			}
+			f.ArgsOption = root.FetchArgs
+			if root.Platform.OS != "" && root.Platform.Arch != "" {
+				f.Platform = root.Platform
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if features == nil {
+		features = []string{DefaultFeatureName}
+	}
+	f.FeaturesOption = strings.Join(features, ",")
+	if err := f.PreRun(); err != nil {
+		return err
+	}
+	return f.Run()
+}
+
+// warnUnusedArgs gives warnings for args from cli that are not declared by any package.
+func (f *fetch) warnUnusedArgs() {
+	declared := make(map[string]bool)
+	f.DepTree.Traversal(func(tree *pkg.DependencyTree) bool {
+		for k := range tree.Context.Args {
+			declared[k] = true
+		}
+		return true
+	})
+	for k := range f.ArgsOption {
+		if !declared[k] {
+			log.WithFields(log.Fields{"arg": k}).Warning("arg is not declared in any " + pkg.PkgFileName + ", it is ignored.")
+		}
+	}
+}
+
+func (f *fetch) isRefreshPackage(packageName string) bool {
+	for _, name := range f.Refresh {
+		if name == packageName {
+			return true
+		}
+	}
+	return false
+}
+
 // fetchSubDependency installs dependencies to a directory.
 // installPath is the root path of sub-dependency(always be the project root).
 // pkgPath: the given package name/path (e.g github.com/google/googletest) from top level package.
@@ -218,6 +312,10 @@ func (f *fetch) fetchSubDependency(pkgPath string, pkgVendorSrcPath string, acti
 
 			if pkgPath == pkg.RootPKG {
 				depTree.Context.PackageName = pkg.RootPKG
+				depTree.Context.Platform = f.Platform
+				// features and args from cli are recorded in the sum file, see FetchPackages.
+				depTree.Context.Features = activeFeatList
+				depTree.Context.FetchArgs = f.ArgsOption
 			} else { // check the package name in its pkg.yaml, then give a warning if it does not match
 				if depTree.Context.PackageName != pkgYaml.PkgName {
 					log.Warningf("package name does not match in pkg.yaml file(top level package name: %s, package name in pkg.yaml: %s).",
@@ -229,7 +327,7 @@ func (f *fetch) fetchSubDependency(pkgPath string, pkgVendorSrcPath string, acti
 
 			// add to build this package.
 			// only all its dependency packages are downloaded, can this package be built.
-			builder := pkgYaml.FindBuilder()
+			builder := pkgYaml.FindBuilderFor(f.Platform.OS)
 			// overwrite the default builder command and cmake lib,
 			// if they are specified here.
 			if !(builder == nil || len(builder) == 0) || pkgYaml.CMakeLib != "" {
@@ -237,6 +335,9 @@ func (f *fetch) fetchSubDependency(pkgPath string, pkgVendorSrcPath string, acti
 				depTree.Context.SelfCMakeLib = pkgYaml.CMakeLib // add cmake include script for this lib
 			}
 
+			// args of this package, which can be used in templates of instructions and cmake lib.
+			depTree.Context.Args = pkg.ResolveArgs(pkgYaml.Args, f.ConfigArgs, f.ArgsOption)
+
 			depTree.IsPkgPackage = true
 			if depTree.Dependencies == nil {
 				depTree.Dependencies = make([]*pkg.DependencyTree, 0)
@@ -264,9 +365,12 @@ func (f *fetch) fetchSubDependency(pkgPath string, pkgVendorSrcPath string, acti
 			if pkgYaml.FormatVersion < pkg.COMPATIBLE_MIN_FORMAT_VERSION {
 				return fmt.Errorf("package format version does not match, require min format version is %d", pkg.COMPATIBLE_MIN_FORMAT_VERSION)
 			}
+			if pkgYaml.FormatVersion > pkg.FORMAT_VERSION {
+				return fmt.Errorf("package format version %d is newer than the format version %d supported by pkg %s, please upgrade pkg", pkgYaml.FormatVersion, pkg.FORMAT_VERSION, pkg.VERSION)
+			}
 
 			// process features: filter active features and get the optional packages for the features.
-			err, activateFeatPkgs := activeFeatureOptionalPackages(pkgYaml.Features, activeFeatList)
+			err, activateFeatPkgs := activeFeatureOptionalPackages(pkgYaml.Features, activeFeatList, f.Platform)
 			if err != nil {
 				return err
 			}
@@ -319,6 +423,14 @@ func (f *fetch) dlPackagesDepSrc(pkgLock *map[string]string, featPkgList []strin
 		if err := p.setPackageMeta(key, &context); err != nil {
 			return nil, err
 		}
+		context.Platform = f.Platform
+
+		if matched, err := p.condition().Match(f.Platform); err != nil {
+			return nil, fmt.Errorf("package %s: %w", context.PackageName, err)
+		} else if !matched { // skip packages not for the target platform.
+			log.WithFields(log.Fields{"pkg": context.PackageName, "os": f.Platform.OS, "arch": f.Platform.Arch}).Info("skipped package, because its condition does not match the target platform.")
+			continue
+		}
 
 		if context.Optional && !checkOptionalPackageFeatureMatches(context, featPkgList) { // skip optional packages. We do not add to dependency records.
 			log.WithFields(log.Fields{"pkg": context.PackageName}).Info("optional package.")
@@ -332,7 +444,16 @@ func (f *fetch) dlPackagesDepSrc(pkgLock *map[string]string, featPkgList []strin
 		srcDes := context.HomeCacheSrcPath()
 		vendorSrcDes := context.VendorSrcPath(f.PkgHome)
 
-		err, strategy := determinePackageCacheStrategy(context, f.PkgHome, f.NoCache)
+		noCache := f.NoCache
+		if f.isRefreshPackage(context.PackageName) {
+			// remove the package in vendor, and then download it again.
+			if err := os.RemoveAll(vendorSrcDes); err != nil {
+				return nil, err
+			}
+			noCache = true
+		}
+
+		err, strategy := determinePackageCacheStrategy(context, f.PkgHome, noCache)
 		if err != nil {
 			return nil, err
 		}
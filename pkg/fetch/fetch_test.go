@@ -0,0 +1,51 @@
+package fetch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/genshen/pkg"
+)
+
+func TestFetchPackages_KeepOptions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) // global cache directory
+	home := t.TempDir()
+	pkgYaml := "version: 3\nargs:\n  BLAS: openblas\nfeatures:\n  default: {}\n  mpi: {}\n"
+	if err := os.WriteFile(filepath.Join(home, pkg.PkgFileName), []byte(pkgYaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loadRoot := func() pkg.PackageMeta {
+		var metas map[string]pkg.PackageMeta
+		if err := pkg.DepTreeRecover(&metas, pkg.GetPkgSumPath(home)); err != nil {
+			t.Fatal(err)
+		}
+		return metas[pkg.RootPKG]
+	}
+
+	// fetch with options from cli.
+	f := fetch{
+		PkgHome:                home,
+		CMakeFindPackageOption: "NO_DEFAULT_PATH",
+		FeaturesOption:         "mpi",
+		Platform:               pkg.Platform{OS: "darwin", Arch: "arm64"},
+		ArgsOption:             pkg.ArgValues{"BLAS": "mkl"},
+	}
+	if err := f.PreRun(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := loadRoot()
+
+	// fetching again (e.g. after `pkg add`) keeps the options.
+	if err := FetchPackages(home, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	root := loadRoot()
+	if !reflect.DeepEqual(root.Features, []string{"mpi"}) || root.Args["BLAS"] != "mkl" || root.Platform != want.Platform || !reflect.DeepEqual(root, want) {
+		t.Fatalf("expect options of the last fetching kept, but got %+v, want %+v", root, want)
+	}
+}
@@ -1,7 +1,6 @@
 package fetch
 
 import (
-	"fmt"
 	"os"
 
 	"github.com/genshen/pkg"
@@ -12,6 +11,7 @@ import (
 type PackageFetcher interface {
 	setPackageMeta(pkgPath string, meta *pkg.PackageMeta) error
 	fetch(auth map[string]conf.Auth, localReplace, globalReplace map[string]string, srcDes string, meta pkg.PackageMeta) error
+	condition() *pkg.YamlCondition // the platform condition of the package, nil for all platforms.
 }
 
 type YamlGitPkgFetcher pkg.YamlGitPackage
@@ -26,7 +26,7 @@ func (git *YamlGitPkgFetcher) setPackageMeta(pkgPath string, meta *pkg.PackageMe
 	meta.Features = git.Features
 	meta.Optional = git.Optional
 	meta.CMakeLib = git.CMakeLib
-	meta.Builder = git.Build[:]
+	meta.Builder = git.Build.Strings()
 	if meta.CMakeLib == "" && len(meta.Builder) == 0 {
 		// if user specified cmake lib and build commands are not set,
 		// we set self cmake lib and self build commands.
@@ -45,17 +45,7 @@ func (git *YamlGitPkgFetcher) setPackageMeta(pkgPath string, meta *pkg.PackageMe
 }
 
 func (git *YamlGitPkgFetcher) fetch(auth map[string]conf.Auth, localReplace, globalReplace map[string]string, srcDes string, meta pkg.PackageMeta) error {
-	// replace priority: package.path in package's pkg.yaml < local replace in pkg.yaml
-	// < local replace in `pkg.config.yaml` < replace in global config
-	if git.Path == "" {
-		git.Path = fmt.Sprintf("https://%s.git", meta.PackageName)
-	}
-	if replaceAddr, ok := localReplace[meta.PackageName]; ok {
-		git.Path = fmt.Sprintf("https://%s.git", replaceAddr)
-	}
-	if replaceAddr, ok := globalReplace[meta.PackageName]; ok {
-		git.Path = fmt.Sprintf("https://%s.git", replaceAddr)
-	}
+	git.Path = GitRemoteUrl(git.Path, meta.PackageName, localReplace, globalReplace)
 
 	log.WithFields(log.Fields{
 		"pkg": meta.PackageName,
@@ -69,6 +59,10 @@ func (git *YamlGitPkgFetcher) fetch(auth map[string]conf.Auth, localReplace, glo
 	return nil
 }
 
+func (git *YamlGitPkgFetcher) condition() *pkg.YamlCondition {
+	return git.When
+}
+
 // fetcher interface implementation for files package
 func (files *YamlFilesPkgFetcher) setPackageMeta(pkgPath string, meta *pkg.PackageMeta) error {
 	meta.PackageName = pkgPath
@@ -76,7 +70,7 @@ func (files *YamlFilesPkgFetcher) setPackageMeta(pkgPath string, meta *pkg.Packa
 	meta.Version = "latest"
 	meta.Optional = files.Optional
 	meta.CMakeLib = files.CMakeLib
-	meta.Builder = files.Build[:]
+	meta.Builder = files.Build.Strings()
 	return nil
 }
 
@@ -88,6 +82,10 @@ func (files *YamlFilesPkgFetcher) fetch(auth map[string]conf.Auth, localReplace,
 	return nil
 }
 
+func (files *YamlFilesPkgFetcher) condition() *pkg.YamlCondition {
+	return files.When
+}
+
 // fetcher interface implementation for archive package
 func (archive *YamlArchivePkgFetcher) setPackageMeta(pkgPath string, meta *pkg.PackageMeta) error {
 	meta.PackageName = pkgPath
@@ -95,7 +93,7 @@ func (archive *YamlArchivePkgFetcher) setPackageMeta(pkgPath string, meta *pkg.P
 	meta.Version = "latest"
 	meta.Optional = archive.Optional
 	meta.CMakeLib = archive.CMakeLib
-	meta.Builder = archive.Build[:]
+	meta.Builder = archive.Build.Strings()
 	return nil
 }
 
@@ -107,6 +105,10 @@ func (archive *YamlArchivePkgFetcher) fetch(auth map[string]conf.Auth, localRepl
 	return nil
 }
 
+func (archive *YamlArchivePkgFetcher) condition() *pkg.YamlCondition {
+	return archive.When
+}
+
 func gitPkgsToInterface(pkgYaml map[string]pkg.YamlGitPackage) map[string]PackageFetcher {
 	fetchers := make(map[string]PackageFetcher)
 	for k, p := range pkgYaml {
@@ -0,0 +1,123 @@
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/genshen/pkg/conf"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// GitRemoteUrl returns the remote repository url of a git package.
+// path is the package path specified in pkg.yaml, it can be empty.
+// replace priority: package.path in package's pkg.yaml < local replace in pkg.yaml
+// < local replace in `pkg.config.yaml` < replace in global config
+func GitRemoteUrl(path, packageName string, localReplace, globalReplace map[string]string) string {
+	if path == "" {
+		path = fmt.Sprintf("https://%s.git", packageName)
+	}
+	if replaceAddr, ok := localReplace[packageName]; ok {
+		path = fmt.Sprintf("https://%s.git", replaceAddr)
+	}
+	if replaceAddr, ok := globalReplace[packageName]; ok {
+		path = fmt.Sprintf("https://%s.git", replaceAddr)
+	}
+	return path
+}
+
+// gitAuthUrl adds username and token to the repository url, if auth of the url host is configured.
+func gitAuthUrl(auths map[string]conf.Auth, packageUrl string) (string, error) {
+	gitUrl, err := url.Parse(packageUrl)
+	if err != nil {
+		return "", err
+	}
+	if hostAuth, ok := auths[gitUrl.Host]; ok {
+		gitUrl.User = url.UserPassword(hostAuth.Username, hostAuth.Token)
+		return gitUrl.String(), nil
+	}
+	return packageUrl, nil
+}
+
+// ListGitTags lists names of all tags in a remote git repository, without cloning it.
+func ListGitTags(auths map[string]conf.Auth, packageUrl string) ([]string, error) {
+	repoUrl, err := gitAuthUrl(auths, packageUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{repoUrl},
+	})
+	refs, err := remote.List(&git.ListOptions{
+		PeelingOption: git.IgnorePeeled,
+		ProxyOptions: transport.ProxyOptions{
+			URL: getProxyOptionFromEnvVars(repoUrl),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0)
+	for _, ref := range refs {
+		if ref.Name().IsTag() {
+			tags = append(tags, ref.Name().Short())
+		}
+	}
+	return tags, nil
+}
+
+// ListArchiveVersions downloads the page at versionUrl (e.g. a release list page)
+// and returns all versions matched by the regular expression versionRegex.
+// If the expression has a capturing group, the first group is used as the version.
+func ListArchiveVersions(versionUrl, versionRegex string) ([]string, error) {
+	reg, err := regexp.Compile(versionRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	client := http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(getHttpClientProxy(versionUrl)),
+		},
+	}
+	res, err := client.Get(versionUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return nil, errors.New("http response code is not ok (200)")
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return MatchVersions(reg, string(body)), nil
+}
+
+// MatchVersions returns all versions matched by reg in content, duplicated versions are removed.
+// If the expression has a capturing group, the first group is used as the version.
+func MatchVersions(reg *regexp.Regexp, content string) []string {
+	versions := make([]string, 0)
+	flag := make(map[string]bool)
+	for _, match := range reg.FindAllStringSubmatch(content, -1) {
+		version := match[0]
+		if len(match) > 1 {
+			version = match[1]
+		}
+		if _, ok := flag[version]; !ok {
+			flag[version] = true
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
@@ -238,14 +238,9 @@ func gitSrc(auths map[string]conf.Auth, packageCacheDir, packagePath, packageUrl
 		Debugln("downloading dependency to temporary directory.")
 
 	// generate auth repository url.
-	repoUrl := packageUrl
-	if gitUrl, err := url.Parse(packageUrl); err != nil {
+	repoUrl, err := gitAuthUrl(auths, packageUrl)
+	if err != nil {
 		return err
-	} else {
-		if hostAuth, ok := auths[gitUrl.Host]; ok {
-			gitUrl.User = url.UserPassword(hostAuth.Username, hostAuth.Token)
-			repoUrl = gitUrl.String()
-		}
 	}
 
 	// setup proxy if possible
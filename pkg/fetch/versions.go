@@ -0,0 +1,79 @@
+package fetch
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/rogpeppe/go-internal/semver"
+)
+
+// version in a tag, e.g. `v1.2.3`, `release-1.8.0`, `boost_1_84_0`.
+// tags of pre-release versions (e.g. `v1.0.0-rc1`) are not matched.
+var tagVersionRegexp = regexp.MustCompile(`^([^0-9]*?)[vV]?(\d+)(?:[._](\d+))?(?:[._](\d+))?$`)
+
+type tagVersion struct {
+	Tag     string // the original tag
+	Prefix  string // prefix of the tag before version numbers, e.g. `release-`
+	Version string // canonical semantic version, e.g. `v1.8.0`
+}
+
+// parseTagVersion parses a git tag or archive version into prefix and semantic version.
+func parseTagVersion(tag string) (tagVersion, bool) {
+	match := tagVersionRegexp.FindStringSubmatch(tag)
+	if match == nil {
+		return tagVersion{}, false
+	}
+	// normalize version numbers, e.g. `01` to `1`, missing minor and patch to `0`.
+	nums := make([]string, 3)
+	for i := 0; i < 3; i++ {
+		if match[i+2] == "" {
+			nums[i] = "0"
+		} else if n, err := strconv.Atoi(match[i+2]); err != nil {
+			return tagVersion{}, false
+		} else {
+			nums[i] = strconv.Itoa(n)
+		}
+	}
+	version := "v" + nums[0] + "." + nums[1] + "." + nums[2]
+	if !semver.IsValid(version) {
+		return tagVersion{}, false
+	}
+	return tagVersion{Tag: tag, Prefix: match[1], Version: version}, true
+}
+
+// LatestVersions finds the latest compatible version (same major version as current)
+// and the latest version from the candidate tags.
+// If current is a version, only tags with the same prefix are compared.
+// Empty strings are returned if no version is found.
+func LatestVersions(current string, tags []string) (compatible string, latest string) {
+	cur, curOk := parseTagVersion(current)
+	var compatibleVer, latestVer tagVersion
+	for _, tag := range tags {
+		v, ok := parseTagVersion(tag)
+		if !ok {
+			continue
+		}
+		if curOk && v.Prefix != cur.Prefix {
+			continue
+		}
+		if latestVer.Version == "" || semver.Compare(v.Version, latestVer.Version) > 0 {
+			latestVer = v
+		}
+		if curOk && semver.Major(v.Version) == semver.Major(cur.Version) && semver.Compare(v.Version, cur.Version) >= 0 {
+			if compatibleVer.Version == "" || semver.Compare(v.Version, compatibleVer.Version) > 0 {
+				compatibleVer = v
+			}
+		}
+	}
+	return compatibleVer.Tag, latestVer.Tag
+}
+
+// IsNewerVersion returns true if version `other` is newer than version `current`.
+func IsNewerVersion(current, other string) bool {
+	cur, curOk := parseTagVersion(current)
+	v, ok := parseTagVersion(other)
+	if !curOk || !ok {
+		return false
+	}
+	return semver.Compare(v.Version, cur.Version) > 0
+}
@@ -0,0 +1,45 @@
+package fetch
+
+import "testing"
+
+func TestParseTagVersion(t *testing.T) {
+	cases := []struct {
+		tag, prefix, version string
+		ok                   bool
+	}{
+		{"v1.2.3", "", "v1.2.3", true},
+		{"10.2.1", "", "v10.2.1", true},
+		{"release-1.8.0", "release-", "v1.8.0", true},
+		{"boost_1_84_0", "boost_", "v1.84.0", true},
+		{"v2", "", "v2.0.0", true},
+		{"v1.0.0-rc1", "", "", false},
+		{"master", "", "", false},
+	}
+	for _, c := range cases {
+		v, ok := parseTagVersion(c.tag)
+		if ok != c.ok || v.Prefix != c.prefix || v.Version != c.version {
+			t.Errorf("parse tag %s: got (%s, %s, %v)", c.tag, v.Prefix, v.Version, ok)
+		}
+	}
+}
+
+func TestLatestVersions(t *testing.T) {
+	tags := []string{"release-1.8.0", "release-1.8.1", "release-1.10.0", "v1.13.0", "v1.14.0", "v2.0.0-rc1", "main"}
+	compatible, latest := LatestVersions("release-1.8.0", tags)
+	if compatible != "release-1.10.0" || latest != "release-1.10.0" {
+		t.Errorf("unexpected versions: compatible %s, latest %s", compatible, latest)
+	}
+
+	compatible, latest = LatestVersions("v1.13.0", append(tags, "v2.1.0"))
+	if compatible != "v1.14.0" || latest != "v2.1.0" {
+		t.Errorf("unexpected versions: compatible %s, latest %s", compatible, latest)
+	}
+
+	compatible, latest = LatestVersions("main", tags)
+	if compatible != "" || latest != "release-1.10.0" && latest != "v1.14.0" {
+		t.Errorf("unexpected versions of branch: compatible %s, latest %s", compatible, latest)
+	}
+	if !IsNewerVersion("release-1.8.0", "release-1.10.0") || IsNewerVersion("main", "v1.14.0") {
+		t.Error("unexpected result of version comparing")
+	}
+}
@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/genshen/cmds"
+	"github.com/genshen/pkg"
+)
+
+var graphCommand = &cmds.Command{
+	Name:        "graph",
+	Summary:     "print the dependency graph of all packages",
+	Description: "print the dependency graph of all packages in dot, json or mermaid format.",
+	CustomFlags: false,
+	HasOptions:  true,
+}
+
+func init() {
+	var pwd string
+	var err error
+	if pwd, err = os.Getwd(); err != nil {
+		pwd = "./"
+	}
+
+	var g graph
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	graphCommand.FlagSet = fs
+	graphCommand.FlagSet.StringVar(&g.home, "home", pwd, "path of home directory")
+	graphCommand.FlagSet.StringVar(&g.format, "format", pkg.GraphFormatDot, "output format of the graph: dot, json or mermaid")
+	graphCommand.FlagSet.StringVar(&g.output, "o", "", "path to save the graph, default is stdout")
+	graphCommand.FlagSet.Usage = graphCommand.Usage // use default usage provided by cmds.Command.
+	graphCommand.Runner = &g
+	cmds.AllCommands = append(cmds.AllCommands, graphCommand)
+}
+
+type graph struct {
+	home   string
+	format string
+	output string
+	graph  *pkg.DependencyGraph
+}
+
+func (g *graph) PreRun() error {
+	if g.home == "" {
+		return errors.New("flag home is required")
+	}
+	if g.format != pkg.GraphFormatDot && g.format != pkg.GraphFormatJson && g.format != pkg.GraphFormatMermaid {
+		return fmt.Errorf("unsupported graph format `%s`", g.format)
+	}
+
+	// check graph file
+	graphPath := pkg.GetDepGraphPath(g.home)
+	if fileInfo, err := os.Stat(graphPath); err != nil {
+		return fmt.Errorf(`stat file %s failed, make sure you have run "pkg fetch"; error: %s`, graphPath, err)
+	} else if fileInfo.IsDir() {
+		return fmt.Errorf("%s is not a file", graphPath)
+	}
+
+	if depGraph, err := pkg.LoadGraph(graphPath); err != nil {
+		return err
+	} else {
+		g.graph = depGraph
+	}
+	return nil
+}
+
+func (g *graph) Run() error {
+	var writer io.Writer = os.Stdout
+	if g.output != "" {
+		if file, err := os.Create(g.output); err != nil {
+			return err
+		} else {
+			defer file.Close()
+			writer = file
+		}
+	}
+	return g.graph.Write(writer, g.format)
+}
@@ -0,0 +1,298 @@
+package install
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/genshen/pkg"
+	cp "github.com/otiai10/copy"
+	log "github.com/sirupsen/logrus"
+)
+
+// placeholders of absolute paths in cached artifacts, they are replaced back with paths in the project while restoring.
+const (
+	artifactPrefixHolder = "@PKG_ARTIFACT_PREFIX@"
+	artifactVendorHolder = "@PKG_ARTIFACT_VENDOR@"
+	artifactHomeHolder   = "@PKG_ARTIFACT_HOME@"
+)
+
+// relocatableExts are extensions of installed files containing absolute install prefix, e.g. cmake config and pkg-config files.
+var relocatableExts = []string{".cmake", ".pc", ".la"}
+
+// artifactCache caches installed trees (vendor/pkg/@pkg) of packages in $HOME/.pkg/artifacts/@key, shared by projects.
+// The key is the hash of the package source identity (name, version, target and the content of its source tree), the expanded instructions
+// (with the project path replaced), features, args, cmake arguments, build config, toolchain profile
+// and the keys of its dependencies.
+// Packages installing files to the shared include directory are not cached.
+type artifactCache struct {
+	dir     string // $HOME/.pkg/artifacts
+	pkgHome string
+	config  buildConfig
+	salt    string // other inputs affecting all packages, e.g. cmake arguments from cli.
+
+	mu   sync.Mutex
+	keys map[string]string // keys of packages computed in this run
+}
+
+func newArtifactCache(pkgHome string, config buildConfig, salt string) (*artifactCache, error) {
+	dir, err := pkg.GetArtifactCachePath()
+	if err != nil {
+		return nil, err
+	}
+	return &artifactCache{dir: dir, pkgHome: pkgHome, config: config, salt: salt, keys: make(map[string]string)}, nil
+}
+
+// key computes the cache key of a package. Empty key is returned if the key of a dependency is unknown.
+// deps: direct dependencies of the package.
+func (a *artifactCache) key(meta *pkg.PackageMeta, metas map[string]pkg.PackageMeta, deps []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "package: %s@%s#%s\n", meta.PackageName, meta.Version, meta.TargetName)
+	// version "latest" of files/archive packages and git branches do not identify the source, so the source content is hashed.
+	if err := hashSourceContent(h, meta.VendorSrcPath(a.pkgHome)); err != nil {
+		return "", err
+	}
+	// paths in the project (e.g. toolchain file of the profile, cli cmake arguments) are replaced,
+	// thus the key is independent of the project path.
+	fmt.Fprintf(h, "salt: %s\n", a.homeHolder(a.salt))
+	fmt.Fprintf(h, "build type: %s\n", a.config.buildType)
+	fmt.Fprintf(h, "generator: %s\n", a.config.generator)
+	fmt.Fprintf(h, "profile: %s %s %s\n", a.config.profileName, a.homeHolder(a.config.profile.CMakeConfigArgs()), a.homeHolder(strings.Join(a.config.environ(), " ")))
+	fmt.Fprintf(h, "features: %s\n", strings.Join(meta.Features, ","))
+	argKeys := make([]string, 0, len(meta.Args))
+	for k := range meta.Args {
+		argKeys = append(argKeys, k)
+	}
+	sort.Strings(argKeys)
+	for _, k := range argKeys {
+		fmt.Fprintf(h, "arg: %s=%s\n", k, meta.Args[k])
+	}
+	if instructions, err := expandInstructions(a.pkgHome, a.config, meta, metas); err != nil {
+		return "", err
+	} else {
+		for _, ins := range instructions {
+			fmt.Fprintf(h, "ins: %s\n", a.homeHolder(ins))
+		}
+	}
+
+	sortedDeps := append([]string{}, deps...)
+	sort.Strings(sortedDeps)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, dep := range sortedDeps {
+		depKey, ok := a.keys[dep]
+		if !ok || depKey == "" {
+			a.keys[meta.PackageName] = ""
+			return "", nil
+		}
+		fmt.Fprintf(h, "dep: %s %s\n", dep, depKey)
+	}
+	key := hex.EncodeToString(h.Sum(nil))
+	a.keys[meta.PackageName] = key
+	return key, nil
+}
+
+// hashSourceContent writes the relative paths, modes and contents of files in the source directory to h.
+// Unlike hashSourceTree, modification times are ignored, thus the same source fetched in different projects has the same hash.
+func hashSourceContent(h io.Writer, src string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil // e.g. the root package
+	}
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "src: %s %s\n", filepath.ToSlash(rel), info.Mode())
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if target, err := os.Readlink(path); err != nil {
+				return err
+			} else {
+				fmt.Fprintf(h, "link: %s\n", target)
+			}
+		case info.Mode().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+			fmt.Fprintln(h)
+		}
+		return nil
+	})
+}
+
+// homeHolder replaces the project path in s with the placeholder.
+func (a *artifactCache) homeHolder(s string) string {
+	return strings.ReplaceAll(s, a.pkgHome, artifactHomeHolder)
+}
+
+// loadKey loads the key saved when the package was installed, it is used for up-to-date packages,
+// thus their source trees are not hashed. The key is empty if it is not saved.
+func (a *artifactCache) loadKey(name string) {
+	key := ""
+	if content, err := os.ReadFile(pkg.GetArtifactKeyPath(a.pkgHome, a.config.name(), name)); err == nil {
+		key = strings.TrimSpace(string(content))
+	}
+	a.mu.Lock()
+	a.keys[name] = key
+	a.mu.Unlock()
+}
+
+// saveKey saves the key of an installed package, the saved key is removed by stampChecker.invalidate.
+func (a *artifactCache) saveKey(name, key string) error {
+	if key == "" {
+		return nil
+	}
+	keyPath := pkg.GetArtifactKeyPath(a.pkgHome, a.config.name(), name)
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(keyPath, []byte(key+"\n"), 0644)
+}
+
+// replacer returns the replacer from absolute paths of the project to placeholders (if toHolders is true), or reverse.
+func (a *artifactCache) replacer(meta *pkg.PackageMeta, toHolders bool) *strings.Replacer {
+	pairs := [][2]string{
+		{pkg.GetPackagePkgPathOf(a.pkgHome, a.config.name(), meta.PackageName), artifactPrefixHolder},
+		{pkg.GetVendorPath(a.pkgHome), artifactVendorHolder},
+		{a.pkgHome, artifactHomeHolder},
+	}
+	var args []string
+	for _, pair := range pairs {
+		if toHolders {
+			args = append(args, pair[0], pair[1])
+		} else {
+			args = append(args, pair[1], pair[0])
+		}
+	}
+	return strings.NewReplacer(args...)
+}
+
+// restore installs the package from the cache, it returns false if the package is not cached.
+func (a *artifactCache) restore(meta *pkg.PackageMeta, key string) (bool, error) {
+	if key == "" {
+		return false, nil
+	}
+	cached := filepath.Join(a.dir, key)
+	if info, err := os.Stat(cached); err != nil || !info.IsDir() {
+		return false, nil
+	}
+	prefix := pkg.GetPackagePkgPathOf(a.pkgHome, a.config.name(), meta.PackageName)
+	if err := os.RemoveAll(prefix); err != nil {
+		return false, err
+	}
+	if err := cp.Copy(cached, prefix, cp.Options{PreserveTimes: true}); err != nil {
+		return false, err
+	}
+	if err := relocateTree(prefix, a.replacer(meta, false)); err != nil {
+		return false, err
+	}
+	// record the installed files, thus the package can be uninstalled.
+	if err := newInstallRecorder(a.pkgHome, a.config.name()).finish(meta); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// store saves the installed tree of a package to the cache.
+func (a *artifactCache) store(meta *pkg.PackageMeta, key string) error {
+	if key == "" {
+		return nil
+	}
+	prefix := pkg.GetPackagePkgPathOf(a.pkgHome, a.config.name(), meta.PackageName)
+	if info, err := os.Stat(prefix); err != nil || !info.IsDir() {
+		return nil // nothing installed
+	}
+	// files in the shared directory can not be restored from the cache of install prefix.
+	if manifest, err := pkg.LoadManifest(pkg.GetManifestPath(a.pkgHome, a.config.name(), meta.PackageName)); err != nil {
+		return nil
+	} else {
+		for _, file := range manifest.Files {
+			if isSharedFile(file) {
+				log.WithFields(log.Fields{"pkg": meta.PackageName}).Debug("package installs files to shared include directory, it is not cached.")
+				return nil
+			}
+		}
+	}
+
+	cached := filepath.Join(a.dir, key)
+	if _, err := os.Stat(cached); err == nil {
+		return nil // cached by another project
+	}
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return err
+	}
+	temp, err := os.MkdirTemp(a.dir, key+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(temp) // the temp directory is removed if it is not renamed.
+	if err := cp.Copy(prefix, temp, cp.Options{PreserveTimes: true}); err != nil {
+		return err
+	}
+	if err := relocateTree(temp, a.replacer(meta, true)); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, cached); err != nil {
+		if _, statErr := os.Stat(cached); statErr == nil {
+			return nil // stored concurrently
+		}
+		return err
+	}
+	return nil
+}
+
+// relocateTree rewrites absolute paths in relocatable files (see relocatableExts) in dir by replacer.
+func relocateTree(dir string, replacer *strings.Replacer) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || !isRelocatable(path) {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if replaced := replacer.Replace(string(content)); replaced != string(content) {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(path, []byte(replaced), info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func isRelocatable(path string) bool {
+	for _, ext := range relocatableExts {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package install
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/genshen/pkg"
+)
+
+func TestArtifactCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	config := buildConfig{buildType: pkg.DefaultBuildType}
+	meta := pkg.PackageMeta{PackageName: "foo", Version: "v1", Builder: []string{"CMAKE -DOUT={{.PKG_DIR}}"}}
+	metas := map[string]pkg.PackageMeta{"foo": meta}
+	newCache := func(home string) *artifactCache {
+		// the toolchain file and cli arguments in the project are resolved to absolute paths.
+		c := config
+		c.profile.ToolchainFile = filepath.Join(home, "toolchain.cmake")
+		return &artifactCache{dir: cacheDir, pkgHome: home, config: c, salt: "-DOPT=" + filepath.Join(home, "opt"), keys: make(map[string]string)}
+	}
+
+	// install the package in the first project, and save it to the cache.
+	home1, home2 := t.TempDir(), t.TempDir()
+	cache1 := newCache(home1)
+	key1, err := cache1.key(&meta, metas, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix1 := pkg.GetPackagePkgPathOf(home1, config.name(), "foo")
+	cmakeConfig := filepath.Join("lib", "cmake", "foo", "fooConfig.cmake")
+	if err := os.MkdirAll(filepath.Join(prefix1, filepath.Dir(cmakeConfig)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(prefix1, cmakeConfig), []byte("set(FOO_PREFIX \""+prefix1+"\")\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newInstallRecorder(home1, config.name()).finish(&meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache1.store(&meta, key1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the key is independent of the project path.
+	cache2 := newCache(home2)
+	key2, err := cache2.key(&meta, metas, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key1 != key2 {
+		t.Fatalf("expect the same key in different projects, but got %s and %s", key1, key2)
+	}
+	if restored, err := cache2.restore(&meta, key2); err != nil || !restored {
+		t.Fatalf("expect package restored, but got %v, %v", restored, err)
+	}
+	prefix2 := pkg.GetPackagePkgPathOf(home2, config.name(), "foo")
+	if content, err := os.ReadFile(filepath.Join(prefix2, cmakeConfig)); err != nil || string(content) != "set(FOO_PREFIX \""+prefix2+"\")\n" {
+		t.Errorf("expect prefix relocated, but got %q, %v", content, err)
+	}
+	if _, err := os.Stat(pkg.GetManifestPath(home2, config.name(), "foo")); err != nil {
+		t.Errorf("expect manifest written for restored package, but got %v", err)
+	}
+
+	// changing the source under the same version changes the key, thus the cache is missed.
+	src := meta.VendorSrcPath(home2)
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "foo.c"), []byte("int foo() { return 2; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	key3, err := newCache(home2).key(&meta, metas, nil)
+	if err != nil || key3 == key1 {
+		t.Errorf("expect different key for changed source, but got %s, %v", key3, err)
+	}
+	if restored, err := newCache(home2).restore(&meta, key3); err != nil || restored {
+		t.Errorf("expect cache missed for changed source, but got %v, %v", restored, err)
+	}
+
+	// changing instructions changes the key.
+	changed := meta
+	changed.Builder = []string{"CMAKE -DBAR=ON"}
+	if key, err := newCache(home2).key(&changed, metas, nil); err != nil || key == key1 {
+		t.Errorf("expect different key for different instructions, but got %s, %v", key, err)
+	}
+	// unknown dependency disables the cache.
+	if key, err := newCache(home2).key(&meta, metas, []string{"bar"}); err != nil || key != "" {
+		t.Errorf("expect empty key for unknown dependency, but got %s, %v", key, err)
+	}
+}
+
+func TestArtifactCache_UpToDateKey(t *testing.T) {
+	home, cacheDir := t.TempDir(), t.TempDir()
+	config := buildConfig{buildType: pkg.DefaultBuildType}
+	metas := map[string]pkg.PackageMeta{
+		"a": {PackageName: "a", Version: "v1", SelfBuild: []string{"CMAKE"}},
+		"b": {PackageName: "b", Version: "v1", SelfBuild: []string{"CMAKE"}},
+	}
+	metaA := metas["a"]
+	srcFile := filepath.Join(metaA.VendorSrcPath(home), "a.c")
+	if err := os.MkdirAll(filepath.Dir(srcFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(srcFile, []byte("int a = 1;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deps := map[string][]string{"b": {"a"}}
+	build := func(forcePkgs []string) *artifactCache {
+		cache := &artifactCache{dir: cacheDir, pkgHome: home, config: config, keys: make(map[string]string)}
+		opts := buildOptions{jobs: 1, deps: deps, stamps: newStampChecker(home, config, "", false, forcePkgs), artifacts: cache}
+		if err := buildPkg(context.Background(), &insRecorder{installs: newInstallRecorder(home, config.name())}, []string{"a", "b"}, metas, opts); err != nil {
+			t.Fatal(err)
+		}
+		return cache
+	}
+	keyA := build(nil).keys["a"]
+	if keyA == "" {
+		t.Fatal("expect key of package a computed")
+	}
+
+	// change the content of a without changing its size and modification time:
+	// a is up-to-date, and its saved key is used instead of hashing its source again.
+	info, err := os.Stat(srcFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(srcFile, []byte("int a = 2;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(srcFile, time.Now(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	cache := build([]string{"b"})
+	if cache.keys["a"] != keyA {
+		t.Errorf("expect saved key %s used for up-to-date package, but got %s", keyA, cache.keys["a"])
+	}
+	if cache.keys["b"] == "" {
+		t.Error("expect key of package b computed from the saved key of its dependency")
+	}
+}
@@ -0,0 +1,132 @@
+package install
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/genshen/pkg"
+)
+
+// CommandError is the error of a failed command while building a package.
+type CommandError struct {
+	Package     string // package name
+	Instruction string // the instruction running the command, e.g. RUN, CMAKE
+	Command     string // the shell script
+	WorkDir     string // working directory of the command
+	LogFile     string // path of the log file saving output of the command
+	Err         error
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("instruction %s failed: %s (log file: %s)", e.Instruction, e.Err, e.LogFile)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Summary returns details of the failure, including the last n lines of the log file.
+func (e *CommandError) Summary(n int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "package:     %s\n", e.Package)
+	fmt.Fprintf(&sb, "instruction: %s\n", e.Instruction)
+	fmt.Fprintf(&sb, "command:     %s\n", e.Command)
+	fmt.Fprintf(&sb, "work dir:    %s\n", e.WorkDir)
+	fmt.Fprintf(&sb, "error:       %s\n", e.Err)
+	if e.LogFile != "" {
+		fmt.Fprintf(&sb, "log file:    %s\n", e.LogFile)
+		if lines, err := tailFile(e.LogFile, n); err == nil && len(lines) != 0 {
+			fmt.Fprintf(&sb, "last %d lines of the log:\n", len(lines))
+			for _, line := range lines {
+				sb.WriteString("    " + line + "\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// CommandErrors returns all CommandError in err, err can be a joined error.
+func CommandErrors(err error) []*CommandError {
+	// check joined errors first, because errors.As only finds the first one in them.
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var result []*CommandError
+		for _, e := range joined.Unwrap() {
+			result = append(result, CommandErrors(e)...)
+		}
+		return result
+	}
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return []*CommandError{cmdErr}
+	}
+	return nil
+}
+
+// tailFile returns the last n lines of a file.
+func tailFile(path string, n int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := make([]string, 0, n)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(lines) == n {
+			lines = lines[1:]
+		}
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// buildLogs manages log files of packages: each command of a package writes its output to
+// vendor/logs/@pkg/@config-@step-@verb.log, where step is the index of the command in the package building.
+type buildLogs struct {
+	pkgHome string
+	config  string // name of the build config
+	mu      sync.Mutex
+	steps   map[string]int // step counter of each package
+}
+
+func newBuildLogs(pkgHome, config string) *buildLogs {
+	return &buildLogs{pkgHome: pkgHome, config: config, steps: make(map[string]int)}
+}
+
+// reset removes old log files of a package in the build config, it is called before building the package.
+func (b *buildLogs) reset(packageName string) error {
+	b.mu.Lock()
+	b.steps[packageName] = 0
+	b.mu.Unlock()
+	oldLogs, err := filepath.Glob(filepath.Join(pkg.GetPackageLogPath(b.pkgHome, packageName), b.config+"-*.log"))
+	if err != nil {
+		return err
+	}
+	for _, file := range oldLogs {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// create creates the log file for the next command of a package.
+func (b *buildLogs) create(packageName, verb string) (*os.File, error) {
+	b.mu.Lock()
+	b.steps[packageName]++
+	step := b.steps[packageName]
+	b.mu.Unlock()
+
+	logDir := pkg.GetPackageLogPath(b.pkgHome, packageName)
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(filepath.Join(logDir, fmt.Sprintf("%s-%02d-%s.log", b.config, step, verb)))
+}
@@ -0,0 +1,33 @@
+package install
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommandErrors(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "01-run.log")
+	var content strings.Builder
+	for i := 1; i <= 30; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	if err := os.WriteFile(logFile, []byte(content.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmdErr := &CommandError{Package: "foo", Instruction: "RUN", Command: "make", WorkDir: "/tmp", LogFile: logFile, Err: errors.New("exit status 2")}
+	err := errors.Join(fmt.Errorf("build package foo failed: %w", cmdErr), errors.New("other error"))
+	cmdErrs := CommandErrors(err)
+	if len(cmdErrs) != 1 || cmdErrs[0] != cmdErr {
+		t.Fatalf("expect the command error found, but got %v", cmdErrs)
+	}
+
+	summary := cmdErr.Summary(3)
+	if !strings.Contains(summary, "line 28\n    line 29\n    line 30\n") || strings.Contains(summary, "line 27") {
+		t.Errorf("expect the last 3 lines in summary, but got:\n%s", summary)
+	}
+}
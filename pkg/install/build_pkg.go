@@ -1,85 +1,333 @@
 package install
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/genshen/pkg"
+	log "github.com/sirupsen/logrus"
 )
 
+// options for scheduling package building.
+type buildOptions struct {
+	jobs      int                 // max number of packages built concurrently.
+	keepGoing bool                // keep building other packages after a package failed.
+	deps      map[string][]string // direct dependencies of each package, from the dependency graph.
+	timeout   time.Duration       // timeout of each instruction, 0 for no timeout.
+	stamps    *stampChecker       // skip up-to-date packages by stamps, nil for building all packages.
+	artifacts *artifactCache      // restore packages from the artifact cache, nil for disabling the cache. It works with stamps.
+	report    *buildReport        // record results of packages, can be nil.
+}
+
 // build pkg from dependency tree.
+// Packages are built in topological order of the dependency graph,
+// and independent packages can be built concurrently (up to opts.jobs packages).
 // inst: instruction interface
 // list: the package to be built
 // metas: metadata for building packages
-func buildPkg(inst InsInterface, lists []string, metas map[string]pkg.PackageMeta) error {
-	if err := inst.Setup(); err != nil {
-		return nil
+// Building is stopped if ctx is canceled, and the running commands are killed.
+func buildPkg(ctx context.Context, inst InsInterface, lists []string, metas map[string]pkg.PackageMeta, opts buildOptions) error {
+	if err := inst.Setup(ctx); err != nil {
+		return err
 	}
-	for _, item := range lists {
-		meta, ok := metas[item]
-		if !ok {
+	index := make(map[string]int) // index of package in lists, used as priority of scheduling.
+	for i, item := range lists {
+		if _, ok := metas[item]; !ok {
 			return fmt.Errorf("package `%s` not found", item)
 		}
+		index[item] = i
+	}
+	if opts.jobs < 1 {
+		opts.jobs = 1
+	}
 
-		packageEnv, err := inst.PkgPreInstall(&meta)
-		if err != nil {
-			return err
+	// only dependencies in lists are considered, others are treated as built.
+	pending := make(map[string]int)         // number of unfinished dependencies of a package
+	dependents := make(map[string][]string) // packages depending on a package
+	for _, item := range lists {
+		for _, dep := range opts.deps[item] {
+			if _, ok := index[dep]; ok && dep != item {
+				pending[item]++
+				dependents[dep] = append(dependents[dep], item)
+			}
+		}
+	}
+	ready := make([]string, 0)
+	for _, item := range lists {
+		if pending[item] == 0 {
+			ready = append(ready, item)
 		}
+	}
+
+	type buildResult struct {
+		name     string
+		status   string
+		detail   string
+		duration time.Duration
+		err      error
+	}
+	results := make(chan buildResult)
+	skipped := make(map[string]bool)
+	var errs []error
+	running, finished, stop := 0, 0, false
 
-		// if outer build is specified, then inner build will be ignored.
-		if len(meta.Builder) == 0 {
-			// run inner build,(self build).
-			for _, ins := range meta.SelfBuild {
-				if err := RunIns(inst, &meta, packageEnv, ins); err != nil {
-					return err
-				}
+	// skip all packages depending on a failed package.
+	var skipDependents func(name string)
+	skipDependents = func(name string) {
+		for _, d := range dependents[name] {
+			if !skipped[d] {
+				skipped[d] = true
+				finished++
+				opts.report.set(d, pkgBlocked, 0, fmt.Sprintf("dependency %s failed", name))
+				log.WithFields(log.Fields{"pkg": d, "dependency": name}).Warning("skipped package, because its dependency failed.")
+				skipDependents(d)
 			}
-		} else {
-			// run outer build.
-			for _, ins := range meta.Builder {
-				if err := RunIns(inst, &meta, packageEnv, ins); err != nil {
-					return err
-				}
+		}
+	}
+
+	for finished < len(lists) {
+		if ctx.Err() != nil {
+			stop = true // canceled, e.g. by signal or timeout.
+		}
+		for !stop && running < opts.jobs && len(ready) > 0 {
+			name := ready[0]
+			ready = ready[1:]
+			running++
+			go func(name string) {
+				start := time.Now()
+				status, detail, err := buildOnePkgIfChanged(ctx, inst, name, metas, opts)
+				results <- buildResult{name: name, status: status, detail: detail, duration: time.Since(start), err: err}
+			}(name)
+		}
+		if running == 0 {
+			break // stopped on failure, or the remaining packages are in a dependency cycle.
+		}
+
+		r := <-results
+		running--
+		finished++
+		if r.err != nil {
+			opts.report.set(r.name, pkgFailed, r.duration, firstLine(r.err))
+			errs = append(errs, fmt.Errorf("build package %s failed: %w", r.name, r.err))
+			if !opts.keepGoing {
+				stop = true // stop scheduling new packages, and wait for the running packages.
 			}
+			skipDependents(r.name)
+			continue
 		}
-		if err := inst.PkgPostInstall(&meta); err != nil {
-			return err
+		opts.report.set(r.name, r.status, r.duration, r.detail)
+		for _, d := range dependents[r.name] {
+			if pending[d]--; pending[d] == 0 && !skipped[d] {
+				// keep the ready list in the order of lists.
+				pos := sort.Search(len(ready), func(i int) bool { return index[ready[i]] > index[d] })
+				ready = append(ready[:pos], append([]string{d}, ready[pos:]...)...)
+			}
 		}
 	}
+
+	if err := ctx.Err(); err != nil && finished < len(lists) {
+		errs = append(errs, fmt.Errorf("building canceled, %d packages not built: %w", len(lists)-finished, err))
+	}
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+	if finished < len(lists) {
+		return errors.New("dependency cycle detected, some packages can not be built")
+	}
 	return nil
 }
 
+// build and install a single package, if its stamp is changed.
+// It returns the status of the package (built or skipped) and details of the status.
+func buildOnePkgIfChanged(ctx context.Context, inst InsInterface, item string, metas map[string]pkg.PackageMeta, opts buildOptions) (string, string, error) {
+	if opts.stamps == nil {
+		return pkgBuilt, "", buildOnePkg(ctx, inst, item, metas, opts.timeout)
+	}
+	meta := metas[item]
+	stamp, upToDate, err := opts.stamps.check(&meta, metas, opts.deps[item])
+	if err != nil {
+		return "", "", err
+	}
+	if upToDate {
+		log.WithFields(log.Fields{"pkg": item}).Info("package is up-to-date, skipped.")
+		if opts.artifacts != nil {
+			// the key saved when the package was installed is used in keys of its dependents.
+			opts.artifacts.loadKey(item)
+		}
+		return pkgSkipped, "up-to-date", opts.stamps.done(item, stamp, false)
+	}
+	if err := opts.stamps.invalidate(item); err != nil {
+		return "", "", err
+	}
+	// the key (hashing the source content) is only computed for packages to be built.
+	var artifactKey string
+	if opts.artifacts != nil {
+		if artifactKey, err = opts.artifacts.key(&meta, metas, opts.deps[item]); err != nil {
+			return "", "", err
+		}
+	}
+	if opts.artifacts != nil && !opts.stamps.forced(item) { // forced packages are built from source.
+		if restored, err := opts.artifacts.restore(&meta, artifactKey); err != nil {
+			return "", "", err
+		} else if restored {
+			log.WithFields(log.Fields{"pkg": item, "key": artifactKey}).Info("package is restored from artifact cache.")
+			if err := opts.artifacts.saveKey(item, artifactKey); err != nil {
+				return "", "", err
+			}
+			return pkgBuilt, "restored from artifact cache", opts.stamps.done(item, stamp, true)
+		}
+	}
+	if err := buildOnePkg(ctx, inst, item, metas, opts.timeout); err != nil {
+		return "", "", err
+	}
+	if opts.artifacts != nil {
+		// failing to cache the package does not fail the building.
+		if err := opts.artifacts.store(&meta, artifactKey); err != nil {
+			log.WithFields(log.Fields{"pkg": item, "error": err}).Warning("failed to save package to artifact cache.")
+		}
+		if err := opts.artifacts.saveKey(item, artifactKey); err != nil {
+			return "", "", err
+		}
+	}
+	// the source tree can be changed by building (e.g. in-source building), compute the stamp again.
+	if stamp, _, err = opts.stamps.check(&meta, metas, opts.deps[item]); err != nil {
+		return "", "", err
+	}
+	return pkgBuilt, "", opts.stamps.done(item, stamp, true)
+}
+
+// build and install a single package.
+// timeout: timeout of each instruction, 0 for no timeout.
+func buildOnePkg(ctx context.Context, inst InsInterface, item string, metas map[string]pkg.PackageMeta, timeout time.Duration) (err error) {
+	meta := metas[item]
+	packageEnv, err := inst.PkgPreInstall(ctx, &meta)
+	if err != nil {
+		return err
+	}
+	if aborter, ok := inst.(insAborter); ok {
+		defer func() {
+			if err != nil {
+				aborter.pkgAbortInstall(&meta)
+			}
+		}()
+	}
+	packageEnv.Metas = metas // used for referring other packages in templates.
+
+	for i, ins := range buildInstructions(&meta) {
+		insCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			insCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		err := RunIns(insCtx, inst, &meta, packageEnv, i, ins)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return inst.PkgPostInstall(ctx, &meta)
+}
+
+// insAborter is implemented by instruction runners keeping states from PkgPreInstall to PkgPostInstall,
+// pkgAbortInstall is called instead of PkgPostInstall if the package failed to install.
+type insAborter interface {
+	pkgAbortInstall(meta *pkg.PackageMeta)
+}
+
+// buildInstructions returns instructions to build a package.
+// If outer build is specified, then inner build (self build) will be ignored.
+func buildInstructions(meta *pkg.PackageMeta) []string {
+	if len(meta.Builder) == 0 {
+		return meta.SelfBuild
+	}
+	return meta.Builder
+}
+
 // dispatch instruction to run.
-func RunIns(inst InsInterface, meta *pkg.PackageMeta, envs *pkg.PackageEnvs, ins string) error {
+// index is the index of the instruction in the building instructions of the package, used in error messages.
+func RunIns(ctx context.Context, inst InsInterface, meta *pkg.PackageMeta, envs *pkg.PackageEnvs, index int, ins string) error {
 	if expandedIns, err := pkg.ExpandEnv(ins, envs); err != nil {
-		return err
+		return fmt.Errorf("package %s, instruction[%d]: %w", meta.PackageName, index, err)
 	} else {
 		// parse instruction
-		triple, err := pkg.ParseIns(strings.Trim(expandedIns, " "))
+		triple, err := pkg.ParseIns(expandedIns)
 		if err != nil {
-			return err
+			return fmt.Errorf("package %s, instruction[%d]: %w", meta.PackageName, index, err)
 		}
 
-		switch triple.First {
-		case "CP":
-			if err := inst.InsCp(triple, meta); err != nil {
-				return err
-			}
-		case "RUN":
-			if err := inst.InsRun(triple, meta); err != nil {
-				return err
-			}
-		case pkg.InsCmake: // run cmake commands, format: CMAKE {config args} {build args}
-			if err := inst.InsCMake(triple, meta); err != nil {
-				return err
-			}
-		case pkg.InsAutoPkg:
-			if err := inst.InsAutoPkg(triple, meta); err != nil {
-				return err
-			}
+		run := func() error {
+			return dispatchIns(ctx, inst, meta, index, triple)
+		}
+		if w, ok := inst.(insWrapper); ok {
+			return w.wrapIns(meta, triple, run)
+		}
+		return run()
+	}
+}
+
+// insWrapper is implemented by instruction runners which wrap the running of each instruction, e.g. for locking.
+type insWrapper interface {
+	wrapIns(meta *pkg.PackageMeta, triple pkg.InsTriple, run func() error) error
+}
+
+// dispatchIns dispatches a parsed instruction to the runner.
+func dispatchIns(ctx context.Context, inst InsInterface, meta *pkg.PackageMeta, index int, triple pkg.InsTriple) error {
+	switch triple.First {
+	case pkg.InsCp:
+		if err := inst.InsCp(ctx, triple, meta); err != nil {
+			return err
+		}
+	case pkg.InsRun:
+		if err := inst.InsRun(ctx, triple, meta); err != nil {
+			return err
 		}
-		return nil
+	case pkg.InsCmake: // run cmake commands, format: CMAKE {config args} {build args}
+		if err := inst.InsCMake(ctx, triple, meta); err != nil {
+			return err
+		}
+	case pkg.InsAutoPkg:
+		if err := inst.InsAutoPkg(ctx, triple, meta); err != nil {
+			return err
+		}
+	case pkg.InsAutotools: // format: AUTOTOOLS {configure args} {make args}
+		if err := inst.InsAutotools(ctx, triple, meta); err != nil {
+			return err
+		}
+	case pkg.InsMeson: // format: MESON {setup args} {compile args}
+		if err := inst.InsMeson(ctx, triple, meta); err != nil {
+			return err
+		}
+	case pkg.InsMake: // format: MAKE {make args} {make install args}
+		if err := inst.InsMake(ctx, triple, meta); err != nil {
+			return err
+		}
+	case pkg.InsEnv: // format: ENV KEY VALUE
+		if err := inst.InsEnv(ctx, triple, meta); err != nil {
+			return err
+		}
+	case pkg.InsMkdir: // format: MKDIR path
+		if err := inst.InsMkdir(ctx, triple, meta); err != nil {
+			return err
+		}
+	case pkg.InsRm: // format: RM path
+		if err := inst.InsRm(ctx, triple, meta); err != nil {
+			return err
+		}
+	case pkg.InsPatch: // format: PATCH file [strip]
+		if err := inst.InsPatch(ctx, triple, meta); err != nil {
+			return err
+		}
+	case pkg.InsDownload: // format: DOWNLOAD url dest sha256
+		if err := inst.InsDownload(ctx, triple, meta); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("package %s, instruction[%d]: unknown instruction `%s`", meta.PackageName, index, triple.First)
 	}
+	return nil
 }
 
 func featuresToOptions(features []string) string {
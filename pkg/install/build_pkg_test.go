@@ -0,0 +1,176 @@
+package install
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/genshen/pkg"
+)
+
+// insRecorder records the packages built, and fails the building of packages in `fail`.
+// If installs is set, install manifests of the built packages are written.
+type insRecorder struct {
+	mu       sync.Mutex
+	built    []string
+	fail     map[string]bool
+	setupErr error
+	installs *installRecorder
+}
+
+func (r *insRecorder) Setup(ctx context.Context) error { return r.setupErr }
+
+func (r *insRecorder) PkgPreInstall(ctx context.Context, meta *pkg.PackageMeta) (*pkg.PackageEnvs, error) {
+	if r.fail[meta.PackageName] {
+		return nil, errors.New("build failed")
+	}
+	return pkg.NewPackageEnvs("", meta.PackageName, ""), nil
+}
+
+func (r *insRecorder) PkgPostInstall(ctx context.Context, meta *pkg.PackageMeta) error {
+	if r.installs != nil {
+		if err := r.installs.finish(meta); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.built = append(r.built, meta.PackageName)
+	return nil
+}
+
+func (r *insRecorder) InsCp(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return nil
+}
+func (r *insRecorder) InsRun(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return nil
+}
+func (r *insRecorder) InsCMake(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return nil
+}
+func (r *insRecorder) InsAutoPkg(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return nil
+}
+func (r *insRecorder) InsAutotools(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return nil
+}
+func (r *insRecorder) InsMeson(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return nil
+}
+func (r *insRecorder) InsMake(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return nil
+}
+func (r *insRecorder) InsEnv(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return nil
+}
+func (r *insRecorder) InsMkdir(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return nil
+}
+func (r *insRecorder) InsRm(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return nil
+}
+func (r *insRecorder) InsPatch(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return nil
+}
+func (r *insRecorder) InsDownload(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return nil
+}
+
+func TestBuildPkg(t *testing.T) {
+	// d -> {b, c}, b -> {a}, c -> {a}, e (independent)
+	lists := []string{"a", "b", "c", "d", "e"}
+	deps := map[string][]string{"d": {"b", "c"}, "b": {"a"}, "c": {"a"}}
+	metas := make(map[string]pkg.PackageMeta)
+	for _, name := range lists {
+		metas[name] = pkg.PackageMeta{PackageName: name}
+	}
+
+	for _, jobs := range []int{1, 4} {
+		r := &insRecorder{}
+		if err := buildPkg(context.Background(), r, lists, metas, buildOptions{jobs: jobs, deps: deps}); err != nil {
+			t.Fatal(err)
+		}
+		if len(r.built) != len(lists) {
+			t.Fatalf("jobs %d: expect %d packages built, but got %v", jobs, len(lists), r.built)
+		}
+		pos := make(map[string]int)
+		for i, name := range r.built {
+			pos[name] = i
+		}
+		for name, ds := range deps {
+			for _, d := range ds {
+				if pos[d] > pos[name] {
+					t.Errorf("jobs %d: package %s is built before its dependency %s: %v", jobs, name, d, r.built)
+				}
+			}
+		}
+	}
+
+	// with keep-going, packages not depending on the failed package are still built.
+	r := &insRecorder{fail: map[string]bool{"b": true}}
+	if err := buildPkg(context.Background(), r, lists, metas, buildOptions{jobs: 1, keepGoing: true, deps: deps}); err == nil {
+		t.Fatal("expect error when building failed")
+	}
+	if len(r.built) != 3 || r.built[0] != "a" || r.built[1] != "c" || r.built[2] != "e" {
+		t.Errorf("unexpected built packages with keep-going: %v", r.built)
+	}
+
+	// stop on the first failure.
+	r = &insRecorder{fail: map[string]bool{"b": true}}
+	if err := buildPkg(context.Background(), r, lists, metas, buildOptions{jobs: 1, deps: deps}); err == nil {
+		t.Fatal("expect error when building failed")
+	}
+	if len(r.built) != 1 {
+		t.Errorf("unexpected built packages: %v", r.built)
+	}
+
+	// cancellation is reported, rather than a dependency cycle.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r = &insRecorder{}
+	if err := buildPkg(ctx, r, lists, metas, buildOptions{jobs: 1, deps: deps}); !errors.Is(err, context.Canceled) || len(r.built) != 0 {
+		t.Errorf("expect canceled error and no package built, but got %v, %v", err, r.built)
+	}
+}
+
+func TestBuildPkg_Report(t *testing.T) {
+	// d -> {b, c}, b -> {a}, c -> {a}, e (independent)
+	lists := []string{"a", "b", "c", "d", "e"}
+	deps := map[string][]string{"d": {"b", "c"}, "b": {"a"}, "c": {"a"}}
+	metas := make(map[string]pkg.PackageMeta)
+	for _, name := range lists {
+		metas[name] = pkg.PackageMeta{PackageName: name}
+	}
+
+	report := newBuildReport(lists)
+	r := &insRecorder{fail: map[string]bool{"b": true}}
+	if err := buildPkg(context.Background(), r, lists, metas, buildOptions{jobs: 2, keepGoing: true, deps: deps, report: report}); err == nil {
+		t.Fatal("expect error when building failed")
+	}
+	want := map[string]string{"a": pkgBuilt, "b": pkgFailed, "c": pkgBuilt, "d": pkgBlocked, "e": pkgBuilt}
+	for name, status := range want {
+		if report.results[name].status != status {
+			t.Errorf("expect status of package %s is %s, but got %s", name, status, report.results[name].status)
+		}
+	}
+	if failed := report.failed(); len(failed) != 1 || failed[0] != "b" {
+		t.Errorf("unexpected failed packages: %v", failed)
+	}
+	var buf bytes.Buffer
+	if err := report.write(&buf, "Release"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "total: 5 packages, 3 built, 0 skipped, 1 failed, 1 blocked") ||
+		!strings.Contains(buf.String(), "dependency b failed") {
+		t.Errorf("unexpected summary:\n%s", buf.String())
+	}
+
+	// error of setup is returned.
+	r = &insRecorder{setupErr: errors.New("setup failed")}
+	if err := buildPkg(context.Background(), r, lists, metas, buildOptions{jobs: 1, deps: deps}); err == nil || len(r.built) != 0 {
+		t.Errorf("expect setup error returned, but got %v", err)
+	}
+}
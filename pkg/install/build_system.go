@@ -0,0 +1,86 @@
+package install
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/genshen/pkg"
+)
+
+// buildDirs is the directories used by build system instructions (AUTOTOOLS, MESON and MAKE).
+type buildDirs struct {
+	src   string // source directory of the package
+	cache string // build directory, e.g. vendor/cache/@pkg/@config
+	pkg   string // install prefix, e.g. vendor/pkg/@pkg
+}
+
+// insStep is a shell command generated from an instruction.
+type insStep struct {
+	verb    string // name of the step, used in log file name, e.g. autotools-configure
+	workDir string // directory running the command
+	script  string
+}
+
+// joinArgs joins the non-empty arguments with space.
+func joinArgs(args ...string) string {
+	nonEmpty := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg = strings.TrimSpace(arg); arg != "" {
+			nonEmpty = append(nonEmpty, arg)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
+
+// autotoolsSteps generates commands of AUTOTOOLS instruction.
+// format: AUTOTOOLS {configure args} {make args}
+// The configure script is generated by autoreconf if it does not exist,
+// and the package is configured and built in the cache directory (out-of-source build).
+func autotoolsSteps(dirs buildDirs, triple pkg.InsTriple, nJobs int32) []insStep {
+	return []insStep{
+		{"autotools-autoreconf", dirs.src, fmt.Sprintf("if [ ! -x \"%s/configure\" ]; then autoreconf -fi; fi", dirs.src)},
+		{"autotools-configure", dirs.cache, joinArgs(fmt.Sprintf("\"%s/configure\" --prefix=\"%s\"", dirs.src, dirs.pkg), triple.Second)},
+		{"autotools-build", dirs.cache, joinArgs(fmt.Sprintf("make -j %d", nJobs), triple.Third)},
+		{"autotools-install", dirs.cache, "make install"},
+	}
+}
+
+// mesonSteps generates commands of MESON instruction.
+// format: MESON {setup args} {compile args}
+// The build directory is reconfigured if it is already set up.
+func mesonSteps(dirs buildDirs, triple pkg.InsTriple, nJobs int32, buildType string) []insStep {
+	setupArgs := joinArgs(fmt.Sprintf("\"%s\" \"%s\" --prefix=\"%s\" --libdir=lib --buildtype=%s",
+		dirs.cache, dirs.src, dirs.pkg, mesonBuildType(buildType)), triple.Second)
+	return []insStep{
+		{"meson-setup", dirs.cache, fmt.Sprintf("if [ -d \"%s/meson-private\" ]; then meson setup --reconfigure %s; else meson setup %s; fi",
+			dirs.cache, setupArgs, setupArgs)},
+		{"meson-compile", dirs.cache, joinArgs(fmt.Sprintf("meson compile -C \"%s\" -j %d", dirs.cache, nJobs), triple.Third)},
+		{"meson-install", dirs.cache, fmt.Sprintf("meson install -C \"%s\"", dirs.cache)},
+	}
+}
+
+// mesonBuildType converts cmake build type to meson build type.
+func mesonBuildType(buildType string) string {
+	switch buildType {
+	case "RelWithDebInfo":
+		return "debugoptimized"
+	case "MinSizeRel":
+		return "minsize"
+	default:
+		return strings.ToLower(buildType) // release, debug
+	}
+}
+
+// makeSteps generates commands of MAKE instruction.
+// format: MAKE {make args} {make install args}
+// Plain Makefile projects usually can not be built out-of-source,
+// thus the source is copied to the cache directory and built there.
+// PREFIX and prefix are both passed to make, which are the common names of install prefix in Makefile.
+func makeSteps(dirs buildDirs, triple pkg.InsTriple, nJobs int32) []insStep {
+	prefixArgs := fmt.Sprintf("PREFIX=\"%s\" prefix=\"%s\"", dirs.pkg, dirs.pkg)
+	return []insStep{
+		{"make-copy", dirs.cache, fmt.Sprintf("cp -Rp \"%s/.\" \"%s\"", dirs.src, dirs.cache)},
+		{"make-build", dirs.cache, joinArgs(fmt.Sprintf("make -j %d", nJobs), prefixArgs, triple.Second)},
+		{"make-install", dirs.cache, joinArgs("make install", prefixArgs, triple.Third)},
+	}
+}
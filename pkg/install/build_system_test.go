@@ -0,0 +1,34 @@
+package install
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/genshen/pkg"
+)
+
+func TestBuildSystemSteps(t *testing.T) {
+	dirs := buildDirs{src: "/src", cache: "/cache", pkg: "/pkg"}
+	triple := pkg.InsTriple{Second: "--enable-shared", Third: "V=1"}
+
+	autotools := autotoolsSteps(dirs, triple, 4)
+	if s := autotools[1]; s.workDir != "/cache" || s.script != `"/src/configure" --prefix="/pkg" --enable-shared` {
+		t.Errorf("unexpected configure step: %+v", s)
+	}
+	if s := autotools[2]; s.script != "make -j 4 V=1" {
+		t.Errorf("unexpected build step: %+v", s)
+	}
+
+	meson := mesonSteps(dirs, triple, 4, "RelWithDebInfo")
+	if s := meson[0].script; !strings.Contains(s, `--prefix="/pkg" --libdir=lib --buildtype=debugoptimized --enable-shared`) {
+		t.Errorf("unexpected setup step: %s", s)
+	}
+	if s := meson[1].script; s != `meson compile -C "/cache" -j 4 V=1` {
+		t.Errorf("unexpected compile step: %s", s)
+	}
+
+	makeBuild := makeSteps(dirs, pkg.InsTriple{}, 2)
+	if s := makeBuild[2].script; s != `make install PREFIX="/pkg" prefix="/pkg"` {
+		t.Errorf("unexpected install step: %s", s)
+	}
+}
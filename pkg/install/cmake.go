@@ -0,0 +1,87 @@
+package install
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// value of `cmake-generator` option for detecting the generator automatically.
+const cmakeGeneratorAuto = "auto"
+
+const cmakeCacheFile = "CMakeCache.txt"
+
+// detectCMakeGenerator returns "Ninja" if ninja is found in PATH,
+// otherwise the default generator of cmake (empty string) is used.
+func detectCMakeGenerator() string {
+	if _, err := exec.LookPath("ninja"); err == nil {
+		return "Ninja"
+	}
+	return ""
+}
+
+// cmakeDefaultGenerator returns the generator used by cmake if no generator is specified:
+// the CMAKE_GENERATOR environment variable, or "Unix Makefiles" on unix-like systems.
+// Empty string is returned on Windows, whose default generator depends on the installed Visual Studio.
+func cmakeDefaultGenerator() string {
+	if env := os.Getenv("CMAKE_GENERATOR"); env != "" {
+		return env
+	}
+	if runtime.GOOS == "windows" {
+		return ""
+	}
+	return "Unix Makefiles"
+}
+
+// cmakeGeneratorReusable returns true if a build tree configured by generator cached
+// can be reused by generator want (empty for the default generator of cmake).
+func cmakeGeneratorReusable(cached, want string) bool {
+	if cached == "" { // not configured
+		return true
+	}
+	if want == "" {
+		if want = cmakeDefaultGenerator(); want == "" {
+			return strings.HasPrefix(cached, "Visual Studio")
+		}
+	}
+	return cached == want
+}
+
+// hasParallelArg returns true if the number of parallel jobs is specified in cmake building arguments,
+// e.g. "-j 4", "-j4", "--parallel 4", "--parallel=4".
+func hasParallelArg(args string) bool {
+	for _, arg := range strings.Fields(args) {
+		if arg == "--" { // arguments of the native build tool
+			return false
+		}
+		if strings.HasPrefix(arg, "-j") || arg == "--parallel" || strings.HasPrefix(arg, "--parallel=") {
+			return true
+		}
+	}
+	return false
+}
+
+// cmakeCacheGenerator returns the generator used by an existing cmake build tree,
+// empty string is returned if the build tree is not configured.
+func cmakeCacheGenerator(buildDir string) (string, error) {
+	file, err := os.Open(filepath.Join(buildDir, cmakeCacheFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer file.Close()
+
+	const key = "CMAKE_GENERATOR:INTERNAL="
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, key) {
+			return strings.TrimPrefix(line, key), nil
+		}
+	}
+	return "", scanner.Err()
+}
@@ -0,0 +1,59 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHasParallelArg(t *testing.T) {
+	tests := map[string]bool{
+		"":                        false,
+		"--verbose":               false,
+		"-j 4":                    true,
+		"-j4":                     true,
+		"--parallel 4":            true,
+		"--parallel=4":            true,
+		"--config Release -- -j4": false,
+	}
+	for args, want := range tests {
+		if got := hasParallelArg(args); got != want {
+			t.Errorf("hasParallelArg(%q): expect %v, but got %v", args, want, got)
+		}
+	}
+}
+
+func TestCMakeCacheGenerator(t *testing.T) {
+	dir := t.TempDir()
+	if gen, err := cmakeCacheGenerator(dir); err != nil || gen != "" {
+		t.Fatalf("expect empty generator for unconfigured build tree, but got %q, %v", gen, err)
+	}
+	content := "# This is the CMakeCache file.\nCMAKE_BUILD_TYPE:STRING=Release\nCMAKE_GENERATOR:INTERNAL=Unix Makefiles\n"
+	if err := os.WriteFile(filepath.Join(dir, cmakeCacheFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if gen, err := cmakeCacheGenerator(dir); err != nil || gen != "Unix Makefiles" {
+		t.Fatalf("expect generator `Unix Makefiles`, but got %q, %v", gen, err)
+	}
+}
+
+func TestCMakeGeneratorReusable(t *testing.T) {
+	t.Setenv("CMAKE_GENERATOR", "")
+	if !cmakeGeneratorReusable("", "Ninja") {
+		t.Error("expect unconfigured build tree reusable")
+	}
+	if !cmakeGeneratorReusable("Ninja", "Ninja") {
+		t.Error("expect build tree reusable by the same generator")
+	}
+	if cmakeGeneratorReusable("Unix Makefiles", "Ninja") {
+		t.Error("expect build tree not reusable by another generator")
+	}
+	// the default generator is used if no generator is specified.
+	if cmakeGeneratorReusable("Ninja", "") {
+		t.Error("expect Ninja build tree not reusable by the default generator")
+	}
+	t.Setenv("CMAKE_GENERATOR", "Ninja")
+	if !cmakeGeneratorReusable("Ninja", "") {
+		t.Error("expect Ninja build tree reusable if CMAKE_GENERATOR is Ninja")
+	}
+}
@@ -1,81 +1,116 @@
 package install
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/genshen/pkg"
 	log "github.com/sirupsen/logrus"
 )
 
+// commandWaitDelay is the time waiting for the output pipes of a canceled command to be closed.
+const commandWaitDelay = 10 * time.Second
+
 // run the instruction
 type InsExecutor struct {
 	BaseInsExecutor
-	pkgHome string // home directory of running pkg command
-	verbose bool   // flag to show building logs when running a command
+	pkgHome  string           // home directory of running pkg command
+	verbose  bool             // flag to show building logs when running a command
+	outputMu sync.Mutex       // lock for writing building logs of packages to terminal
+	logs     *buildLogs       // log files of commands
+	installs *installRecorder // files installed by packages
+	envMu    sync.Mutex
+	envs     map[string][]string // environment variables set by ENV instruction of each package
 }
 
-func NewInsExecutor(pkgHome string, verbose bool, nJobs int32, cmakeConfigArg, cmakeBuildArg string) *InsExecutor {
+func NewInsExecutor(pkgHome string, verbose bool, nJobs int32, cmakeConfigArg, cmakeBuildArg string, config buildConfig) *InsExecutor {
 	return &InsExecutor{
 		BaseInsExecutor: BaseInsExecutor{
 			cmakeConfigArg: cmakeConfigArg,
 			cmakeBuildArg:  cmakeBuildArg,
 			nJobs:          nJobs,
+			config:         config,
 		},
-		pkgHome: pkgHome,
-		verbose: verbose,
+		pkgHome:  pkgHome,
+		verbose:  verbose,
+		logs:     newBuildLogs(pkgHome, config.name()),
+		installs: newInstallRecorder(pkgHome, config.name()),
+		envs:     make(map[string][]string),
 	}
 }
 
-func (in *InsExecutor) Setup() error {
+func (in *InsExecutor) Setup(ctx context.Context) error {
 	return nil
 }
 
-func (in *InsExecutor) PkgPreInstall(meta *pkg.PackageMeta) (*pkg.PackageEnvs, error) {
+func (in *InsExecutor) PkgPreInstall(ctx context.Context, meta *pkg.PackageMeta) (*pkg.PackageEnvs, error) {
 	log.WithFields(log.Fields{
-		"pkg": meta.PackageName,
+		"pkg":    meta.PackageName,
+		"config": in.config.name(),
 	}).Info("installing package.")
+	if err := in.logs.reset(meta.PackageName); err != nil {
+		return nil, err
+	}
+	if err := in.installs.begin(meta); err != nil {
+		return nil, err
+	}
+	in.envMu.Lock()
+	delete(in.envs, meta.PackageName)
+	in.envMu.Unlock()
 	// package env
 	packageEnv := pkg.NewPackageEnvs(in.pkgHome, meta.PackageName, meta.VendorSrcPath(in.pkgHome))
+	in.config.setEnvs(packageEnv)
+	packageEnv.SetPackageMeta(meta)
 	return packageEnv, nil
 }
 
-func (in *InsExecutor) PkgPostInstall(meta *pkg.PackageMeta) error {
+func (in *InsExecutor) PkgPostInstall(ctx context.Context, meta *pkg.PackageMeta) error {
+	if err := in.installs.finish(meta); err != nil {
+		return err
+	}
 	log.WithFields(log.Fields{
 		"pkg": meta.PackageName,
 	}).Info("package built and installed.")
 	return nil
 }
 
-func (in *InsExecutor) InsCp(triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+// pkgAbortInstall drops the records of files installed by the package if it failed to install.
+func (in *InsExecutor) pkgAbortInstall(meta *pkg.PackageMeta) {
+	in.installs.abort(meta.PackageName)
+}
+
+// wrapIns runs instructions writing to the shared include directory exclusively, and records the written files.
+func (in *InsExecutor) wrapIns(meta *pkg.PackageMeta, triple pkg.InsTriple, run func() error) error {
+	return in.installs.recordIns(meta, triple, run)
+}
+
+func (in *InsExecutor) InsCp(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
 	if triple.Second == "" || triple.Third == "" {
 		return errors.New("CP instruction must have src and des")
 	}
-	// run copy.
-	srcPath := meta.VendorSrcPath(in.pkgHome)
-	if err := runInsCopy(filepath.Join(srcPath, triple.Second), triple.Third); err != nil {
-		return err
-	}
-	return nil
+	// run copy
+	return newCopyArgs(meta.VendorSrcPath(in.pkgHome), triple.Second, triple.Third).copy()
 }
 
-func (in *InsExecutor) InsRun(triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+func (in *InsExecutor) InsRun(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
 	if triple.Second == "" || triple.Third == "" {
 		return errors.New("RUN instruction must be a triple")
 	}
-	workDir := triple.Second // fixme path not contains space.
+	workDir := triple.Second
 
 	// make dirs
 	if err := os.MkdirAll(workDir, 0744); err != nil {
 		return err
 	}
 	// run the command
-	if err := involveShell(in.pkgHome, workDir, triple.Third, in.verbose); err != nil {
+	if err := in.involveShell(ctx, meta, pkg.InsRun, workDir, triple.Third); err != nil {
 		return err
 	}
 	return nil
@@ -84,10 +119,23 @@ func (in *InsExecutor) InsRun(triple pkg.InsTriple, meta *pkg.PackageMeta) error
 // InsCMake run cmake config and build command from the triple config.
 // Triple Second: cmake config arguments
 // Triple Third: cmake build arguments
-func (in *InsExecutor) InsCMake(triple pkg.InsTriple, meta *pkg.PackageMeta) error {
-	packageCacheDir := pkg.GetCachePath(in.pkgHome, meta.PackageName)
+func (in *InsExecutor) InsCMake(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	packageCacheDir := pkg.GetBuildCachePath(in.pkgHome, in.config.name(), meta.PackageName)
 	srcPath := meta.VendorSrcPath(in.pkgHome)
 
+	// a build tree configured by another generator can not be reused, remove it.
+	if generator, err := cmakeCacheGenerator(packageCacheDir); err != nil {
+		return err
+	} else if !cmakeGeneratorReusable(generator, in.config.generator) {
+		log.WithFields(log.Fields{
+			"pkg":       meta.PackageName,
+			"generator": generator,
+		}).Warningf("cmake generator is changed to %s, the build tree is removed.", in.config.generatorName())
+		if err := os.RemoveAll(packageCacheDir); err != nil {
+			return err
+		}
+	}
+
 	// make sure the dirs exist.
 	if _, err := os.Stat(packageCacheDir); err != nil {
 		if os.IsNotExist(err) {
@@ -103,6 +151,10 @@ func (in *InsExecutor) InsCMake(triple pkg.InsTriple, meta *pkg.PackageMeta) err
 	if meta.Features != nil && len(meta.Features) != 0 {
 		triple.Second = triple.Second + " " + featuresToOptions(meta.Features)
 	}
+	// prepare cmake config from profile
+	if profileArgs := in.config.profile.CMakeConfigArgs(); profileArgs != "" {
+		triple.Second = triple.Second + " " + profileArgs
+	}
 	// prepare cmake config from cli
 	if in.cmakeConfigArg != "" {
 		triple.Second = triple.Second + " " + in.cmakeConfigArg
@@ -114,75 +166,172 @@ func (in *InsExecutor) InsCMake(triple pkg.InsTriple, meta *pkg.PackageMeta) err
 	}
 
 	// check -j argument in install subcommand
-	if strings.Contains(triple.Third, " -j ") || (strings.Contains(triple.Third, " --parallel ")) {
+	if hasParallelArg(triple.Third) {
 		log.Warning("parallel jobs is already specified. Thus the argument `-j` in `install` subcommand is omitted.")
 	} else {
 		// generate n jobs.
-		triple.Third = fmt.Sprintf("%s -j %d", triple.Third, in.nJobs)
+		triple.Third = fmt.Sprintf("%s --parallel %d", triple.Third, in.nJobs)
 	}
 
 	// create script
-	var configCmd = fmt.Sprintf("cmake -S \"%s\" -B \"%s\" -DCMAKE_BUILD_TYPE=Release -DCMAKE_INSTALL_PREFIX=\"%s\" %s",
-		srcPath, packageCacheDir, pkg.GetPackagePkgPath(in.pkgHome, meta.PackageName), triple.Second)
+	var configCmd = fmt.Sprintf("cmake -S \"%s\" -B \"%s\" %s-DCMAKE_BUILD_TYPE=%s -DCMAKE_INSTALL_PREFIX=\"%s\" %s",
+		srcPath, packageCacheDir, in.config.cmakeGeneratorArg(), in.config.buildType,
+		pkg.GetPackagePkgPathOf(in.pkgHome, in.config.name(), meta.PackageName), triple.Second)
 	var buildCmd = fmt.Sprintf("cmake --build \"%s\" --target install %s", packageCacheDir, triple.Third)
 	// todo user customized config
-	if err := involveShell(in.pkgHome, in.pkgHome, configCmd, in.verbose); err != nil {
+	if err := in.involveShell(ctx, meta, "cmake-config", in.pkgHome, configCmd); err != nil {
 		return err
 	}
-	if err := involveShell(in.pkgHome, in.pkgHome, buildCmd, in.verbose); err != nil {
+	if err := in.involveShell(ctx, meta, "cmake-build", in.pkgHome, buildCmd); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (in *InsExecutor) InsAutoPkg(triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+func (in *InsExecutor) InsAutoPkg(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
 	// if it is auto pkg and outer build mode
 	if pkgEnvInc := os.Getenv("PKG_INNER_BUILD"); pkgEnvInc == "" {
 		// use cmake instruction with features (features as cmake options)
 		triple.First = pkg.InsCmake
 		triple.Second = ""
 		triple.Third = ""
-		return in.InsCMake(triple, meta)
+		return in.InsCMake(ctx, triple, meta)
 	}
 	return nil
 }
 
-func involveShell(pkgHome, workDir, script string, verbose bool) error {
-	if verbose {
-		log.Println("running [", script, "] in directory ", workDir)
+func (in *InsExecutor) InsAutotools(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return in.runSteps(ctx, meta, autotoolsSteps(in.buildDirs(meta), triple, in.nJobs))
+}
+
+func (in *InsExecutor) InsMeson(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return in.runSteps(ctx, meta, mesonSteps(in.buildDirs(meta), triple, in.nJobs, in.config.buildType))
+}
+
+func (in *InsExecutor) InsMake(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return in.runSteps(ctx, meta, makeSteps(in.buildDirs(meta), triple, in.nJobs))
+}
+
+func (in *InsExecutor) buildDirs(meta *pkg.PackageMeta) buildDirs {
+	return buildDirs{
+		src:   meta.VendorSrcPath(in.pkgHome),
+		cache: pkg.GetBuildCachePath(in.pkgHome, in.config.name(), meta.PackageName),
+		pkg:   pkg.GetPackagePkgPathOf(in.pkgHome, in.config.name(), meta.PackageName),
 	}
+}
 
-	cmd := exec.Command("sh", "-c", script) // todo only for linux OS or OSX.
-	cmd.Dir = workDir
-	cmakeBuildEnv := fmt.Sprintf("PKG_VENDOR_PATH=%s", pkg.GetVendorPath(pkgHome))
-	cmd.Env = append(os.Environ(), cmakeBuildEnv)
-	if verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+// runSteps runs commands generated from an instruction one by one.
+func (in *InsExecutor) runSteps(ctx context.Context, meta *pkg.PackageMeta, steps []insStep) error {
+	for _, step := range steps {
+		if err := os.MkdirAll(step.workDir, 0744); err != nil {
+			return err
+		}
+		if err := in.involveShell(ctx, meta, step.verb, step.workDir, step.script); err != nil {
+			return err
+		}
 	}
-	if err := cmd.Run(); err != nil {
+	return nil
+}
+
+func (in *InsExecutor) InsEnv(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	env, err := envArgs(triple)
+	if err != nil {
 		return err
 	}
+	in.envMu.Lock()
+	in.envs[meta.PackageName] = append(in.envs[meta.PackageName], env)
+	in.envMu.Unlock()
 	return nil
 }
 
-func runInsCopy(target, des string) error {
-	from, err := os.Open(target)
+func (in *InsExecutor) InsMkdir(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	if triple.Second == "" {
+		return errors.New("MKDIR instruction must have a path")
+	}
+	return os.MkdirAll(insPath(meta.VendorSrcPath(in.pkgHome), triple.Second), 0755)
+}
+
+func (in *InsExecutor) InsRm(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	if triple.Second == "" {
+		return errors.New("RM instruction must have a path")
+	}
+	path := insPath(meta.VendorSrcPath(in.pkgHome), triple.Second)
+	if err := checkInVendor(path, pkg.GetVendorPath(in.pkgHome)); err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
+
+func (in *InsExecutor) InsPatch(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	patchFile, strip, err := patchArgs(triple)
 	if err != nil {
 		return err
 	}
-	defer from.Close()
+	srcPath := meta.VendorSrcPath(in.pkgHome)
+	return in.runSteps(ctx, meta, []insStep{patchStep(srcPath, shellQuote(insPath(srcPath, patchFile)), strip)})
+}
 
-	to, err := os.OpenFile(des, os.O_RDWR|os.O_CREATE, 0666)
+func (in *InsExecutor) InsDownload(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	url, dest, sum, err := downloadArgs(triple)
 	if err != nil {
 		return err
 	}
-	defer to.Close()
+	dest = insPath(meta.VendorSrcPath(in.pkgHome), dest)
+	log.WithFields(log.Fields{"pkg": meta.PackageName, "url": url}).Info("downloading file.")
+	return downloadFile(ctx, url, dest, sum)
+}
 
-	_, err = io.Copy(to, from)
+// involveShell runs a shell script for package meta in directory workDir.
+// The output is saved to a log file of the package (verb is used in the log file name),
+// and in verbose mode, it is also written to terminal with package name as prefix of each line.
+// If the command fails, a CommandError is returned.
+// The command runs in its own process group, and the whole group is killed if ctx is canceled (e.g. by signal or timeout).
+func (in *InsExecutor) involveShell(ctx context.Context, meta *pkg.PackageMeta, verb, workDir, script string) error {
+	logFile, err := in.logs.create(meta.PackageName, strings.ToLower(verb))
 	if err != nil {
 		return err
 	}
+	defer logFile.Close()
+	fmt.Fprintf(logFile, "# running in directory %s\n# %s\n", workDir, script)
+
+	var out io.Writer = logFile
+	var prefixOut *prefixWriter
+	if in.verbose {
+		log.WithFields(log.Fields{"pkg": meta.PackageName}).Println("running [", script, "] in directory ", workDir)
+		prefixOut = newPrefixWriter(os.Stdout, &in.outputMu, fmt.Sprintf("[%s] ", meta.PackageName))
+		out = io.MultiWriter(logFile, prefixOut)
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", script) // todo only for linux OS or OSX.
+	setProcessGroup(cmd)
+	cmd.WaitDelay = commandWaitDelay
+	cmd.Dir = workDir
+	cmakeBuildEnv := fmt.Sprintf("PKG_VENDOR_PATH=%s", pkg.GetVendorPath(in.pkgHome))
+	cmd.Env = append(append(os.Environ(), cmakeBuildEnv), in.config.environ()...)
+	in.envMu.Lock()
+	cmd.Env = append(cmd.Env, in.envs[meta.PackageName]...)
+	in.envMu.Unlock()
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err = cmd.Run()
+	if prefixOut != nil {
+		if flushErr := prefixOut.Flush(); err == nil {
+			err = flushErr
+		}
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = fmt.Errorf("%w (%s)", ctxErr, err)
+		}
+		return &CommandError{
+			Package:     meta.PackageName,
+			Instruction: verb,
+			Command:     script,
+			WorkDir:     workDir,
+			LogFile:     logFile.Name(),
+			Err:         err,
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,99 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cp "github.com/otiai10/copy"
+)
+
+// copyArgs is the arguments of CP instruction, format: CP src dest
+// src is relative to the source directory of the package, and it can be a glob pattern, e.g. include/*.h.
+// If src is a glob pattern or dest ends with "/", the matched files (or directories) are copied into directory dest.
+// Otherwise, src is copied to dest, or into dest if dest is an existing directory, which is the same as `cp -R`.
+// Parent directories of dest are created, and modes and modification times of files are preserved.
+type copyArgs struct {
+	src     string // source path or glob pattern
+	dest    string
+	glob    bool // src is a glob pattern
+	intoDir bool // copy into directory dest
+}
+
+func newCopyArgs(srcDir, src, dest string) copyArgs {
+	args := copyArgs{src: filepath.Join(srcDir, src), dest: dest, glob: strings.ContainsAny(src, "*?[")}
+	args.intoDir = args.glob || strings.HasSuffix(dest, "/")
+	return args
+}
+
+// copy runs the copy in Go.
+func (c copyArgs) copy() error {
+	sources := []string{c.src}
+	if c.glob {
+		if matches, err := filepath.Glob(c.src); err != nil {
+			return fmt.Errorf("bad pattern `%s` of CP instruction: %w", c.src, err)
+		} else if len(matches) == 0 {
+			return fmt.Errorf("no files match `%s` in CP instruction", c.src)
+		} else {
+			sources = matches
+		}
+	} else if _, err := os.Lstat(c.src); err != nil {
+		return err
+	}
+
+	intoDir := c.intoDir
+	if info, err := os.Stat(c.dest); err == nil && info.IsDir() {
+		intoDir = true
+	}
+	opt := cp.Options{PreserveTimes: true}
+	if !intoDir {
+		if err := os.MkdirAll(filepath.Dir(c.dest), 0755); err != nil {
+			return err
+		}
+		return cp.Copy(c.src, c.dest, opt)
+	}
+	if err := os.MkdirAll(c.dest, 0755); err != nil {
+		return err
+	}
+	for _, src := range sources {
+		if err := cp.Copy(src, filepath.Join(c.dest, filepath.Base(src)), opt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// script generates the shell script of the copy, which has the same behavior as copy.
+func (c copyArgs) script() string {
+	var src = fmt.Sprintf("\"%s\"", c.src)
+	if c.glob {
+		src = shellGlob(c.src)
+	}
+	if c.intoDir {
+		return fmt.Sprintf("mkdir -p \"%s\"\ncp -Rp %s \"%s\"\n", c.dest, src, c.dest)
+	}
+	return fmt.Sprintf("mkdir -p \"%s\"\ncp -Rp %s \"%s\"\n", filepath.Dir(c.dest), src, c.dest)
+}
+
+// shellGlob quotes a glob pattern by double quotes for shell, but keeps the glob characters unquoted.
+// Variables (e.g. ${PROJECT_HOME}) in the pattern are still expanded by shell.
+func shellGlob(pattern string) string {
+	var sb strings.Builder
+	quoted := false
+	for _, c := range pattern {
+		isGlob := strings.ContainsRune("*?[]", c)
+		if isGlob == quoted { // open or close the quote
+			sb.WriteByte('"')
+			quoted = !quoted
+		}
+		if !isGlob && strings.ContainsRune("\"\\`", c) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	if quoted {
+		sb.WriteByte('"')
+	}
+	return sb.String()
+}
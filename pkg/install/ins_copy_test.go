@@ -0,0 +1,101 @@
+package install
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// listTree returns "path mode content" of all files in dir.
+func listTree(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if info.IsDir() {
+			files = append(files, rel+"/")
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel+" "+info.Mode().String()+" "+string(content))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestCopyArgs(t *testing.T) {
+	src := t.TempDir()
+	for name, mode := range map[string]os.FileMode{"include/a.h": 0644, "include/b.h": 0644, "include/c.cpp": 0644, "include/sub/d.h": 0644, "bin/tool.sh": 0755} {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		src, dest string
+	}{
+		{"include/a.h", "out/x/a.h"},
+		{"include/a.h", "out/dir/"},
+		{"include", "out/include"},
+		{"include/*.h", "out/headers"},
+		{"bin/tool.sh", "out/tool.sh"},
+	}
+	for _, tt := range tests {
+		goDest, shDest := t.TempDir(), t.TempDir()
+		// a longer existing file must be truncated.
+		for _, dest := range []string{goDest, shDest} {
+			if err := os.MkdirAll(filepath.Join(dest, "out/x"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dest, "out/x/a.h"), []byte("a very long old content"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := newCopyArgs(src, tt.src, filepath.Join(goDest, tt.dest)).copy(); err != nil {
+			t.Fatalf("copy %s to %s: %v", tt.src, tt.dest, err)
+		}
+		script := newCopyArgs(src, tt.src, filepath.Join(shDest, tt.dest)).script()
+		if out, err := exec.Command("sh", "-c", script).CombinedOutput(); err != nil {
+			t.Fatalf("run script %s: %v, %s", script, err, out)
+		}
+		goFiles, shFiles := listTree(t, goDest), listTree(t, shDest)
+		if strings.Join(goFiles, "\n") != strings.Join(shFiles, "\n") {
+			t.Errorf("copy %s to %s: got different results:\n%v\n%v", tt.src, tt.dest, goFiles, shFiles)
+		}
+	}
+
+	dest := t.TempDir()
+	if err := newCopyArgs(src, "include/a.h", filepath.Join(dest, "dir")+"/").copy(); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(filepath.Join(dest, "dir", "a.h")); err != nil || string(content) != "include/a.h" {
+		t.Errorf("unexpected copied file: %q, %v", content, err)
+	}
+
+	if err := newCopyArgs(src, "include/*.txt", t.TempDir()).copy(); err == nil {
+		t.Error("expect error for glob pattern matching no files")
+	}
+}
+
+func TestShellGlob(t *testing.T) {
+	if got := shellGlob("${PROJECT_HOME}/a b/*.h"); got != `"${PROJECT_HOME}/a b/"*".h"` {
+		t.Errorf("unexpected glob: %s", got)
+	}
+}
@@ -0,0 +1,153 @@
+package install
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/genshen/pkg"
+)
+
+// insPath returns the path used in MKDIR, RM, PATCH and DOWNLOAD instructions,
+// relative path is relative to the source directory of the package.
+// Shell variables in path are not expanded.
+func insPath(srcDir, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(srcDir, path)
+}
+
+// checkInVendor makes sure the path removed by RM instruction is in the vendor directory.
+func checkInVendor(path, vendorPath string) error {
+	if rel, err := filepath.Rel(vendorPath, path); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("path `%s` is not in vendor directory %s, it can not be removed by RM instruction", path, vendorPath)
+	}
+	return nil
+}
+
+// envArgs parses arguments of ENV instruction, format: ENV KEY VALUE
+func envArgs(triple pkg.InsTriple) (string, error) {
+	if triple.Second == "" || strings.Contains(triple.Second, "=") {
+		return "", fmt.Errorf("bad variable name `%s` of ENV instruction, format: ENV KEY VALUE", triple.Second)
+	}
+	return triple.Second + "=" + triple.Third, nil
+}
+
+// patchArgs parses arguments of PATCH instruction, format: PATCH file [strip], strip is 1 by default.
+func patchArgs(triple pkg.InsTriple) (string, int, error) {
+	if triple.Second == "" {
+		return "", 0, errors.New("PATCH instruction must have a patch file")
+	}
+	strip := 1
+	if triple.Third != "" {
+		if n, err := strconv.Atoi(triple.Third); err != nil || n < 0 {
+			return "", 0, fmt.Errorf("bad strip number `%s` of PATCH instruction", triple.Third)
+		} else {
+			strip = n
+		}
+	}
+	return triple.Second, strip, nil
+}
+
+// patchStep generates the command to apply a patch in the source directory.
+// The patch is skipped if it is already applied (it can be reversed).
+// patchFile must be quoted for shell.
+func patchStep(srcDir, patchFile string, strip int) insStep {
+	return insStep{"patch", srcDir, fmt.Sprintf(
+		"if patch -p%d -R -s -f --dry-run -i %s >/dev/null 2>&1; then echo \"patch \"%s\" is already applied\"; else patch -p%d -N -i %s; fi",
+		strip, patchFile, patchFile, strip, patchFile)}
+}
+
+// downloadArgs parses arguments of DOWNLOAD instruction, format: DOWNLOAD url dest sha256
+func downloadArgs(triple pkg.InsTriple) (string, string, string, error) {
+	words, err := pkg.SplitInsWords(triple.Third)
+	if err != nil {
+		return "", "", "", err
+	}
+	if triple.Second == "" || len(words) != 2 {
+		return "", "", "", errors.New("DOWNLOAD instruction must have url, dest and sha256 checksum")
+	}
+	sum := strings.ToLower(words[1])
+	if len(sum) != sha256.Size*2 {
+		return "", "", "", fmt.Errorf("bad sha256 checksum `%s` of DOWNLOAD instruction", words[1])
+	}
+	return triple.Second, words[0], sum, nil
+}
+
+// sha256Cmd is the shell command checking sha256 checksums.
+// sha256sum is not available on macOS, where `shasum -a 256` is used.
+const sha256Cmd = "$(command -v sha256sum || echo shasum -a 256)"
+
+// downloadScript generates shell script of DOWNLOAD instruction.
+// dest and its parent directory destDir must be quoted for shell.
+func downloadScript(url, dest, destDir, sum string) string {
+	check := fmt.Sprintf("echo \"%s  \"%s | %s -c", sum, dest, sha256Cmd)
+	return fmt.Sprintf("if ! %s --status 2>/dev/null; then\n  mkdir -p %s\n  curl -fL -o %s %s\n  %s -\nfi\n",
+		check, destDir, dest, shellQuote(url), check)
+}
+
+// downloadFile downloads url to dest and checks its sha256 checksum.
+// It is skipped if dest already exists with the same checksum.
+func downloadFile(ctx context.Context, url, dest, sum string) error {
+	if fileSum, err := fileSha256(dest); err == nil && fileSum == sum {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	client := http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("download %s failed: http response code is %d", url, res.StatusCode)
+	}
+
+	tempFile := dest + ".download"
+	file, err := os.Create(tempFile)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, h), res.Body); err != nil {
+		file.Close()
+		os.Remove(tempFile)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if fileSum := hex.EncodeToString(h.Sum(nil)); fileSum != sum {
+		os.Remove(tempFile)
+		return fmt.Errorf("sha256 checksum mismatch of %s: expect %s, but got %s", url, sum, fileSum)
+	}
+	return os.Rename(tempFile, dest)
+}
+
+func fileSha256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
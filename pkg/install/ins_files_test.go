@@ -0,0 +1,63 @@
+package install
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadFile(t *testing.T) {
+	content := []byte("extra asset")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	sum := sha256.Sum256(content)
+	hexSum := hex.EncodeToString(sum[:])
+
+	dest := filepath.Join(t.TempDir(), "assets", "a.dat")
+	if err := downloadFile(context.Background(), server.URL+"/a.dat", dest, hexSum); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(dest); err != nil || string(got) != string(content) {
+		t.Fatalf("unexpected downloaded file: %q, %v", got, err)
+	}
+
+	// the file with the same checksum is not downloaded again.
+	server.Close()
+	if err := downloadFile(context.Background(), server.URL+"/a.dat", dest, hexSum); err != nil {
+		t.Fatalf("expect download skipped, but got %v", err)
+	}
+
+	// checksum mismatch
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("changed"))
+	}))
+	defer server.Close()
+	badDest := filepath.Join(filepath.Dir(dest), "b.dat")
+	if err := downloadFile(context.Background(), server.URL+"/b.dat", badDest, hexSum); err == nil {
+		t.Fatal("expect checksum mismatch error")
+	}
+	if _, err := os.Stat(badDest); !os.IsNotExist(err) {
+		t.Errorf("expect no file left after checksum mismatch, but got %v", err)
+	}
+}
+
+func TestCheckInVendor(t *testing.T) {
+	vendor := "/home/project/vendor"
+	for path, ok := range map[string]bool{
+		"/home/project/vendor/cache/foo": true,
+		"/home/project/vendor":           false,
+		"/home/project":                  false,
+		"/home/project/vendor2/foo":      false,
+		"/home/project/vendor/../src":    false,
+	} {
+		if err := checkInVendor(filepath.Clean(path), vendor); (err == nil) != ok {
+			t.Errorf("checkInVendor(%s): expect ok %v, but got %v", path, ok, err)
+		}
+	}
+}
@@ -1,25 +1,95 @@
 package install
 
-import "github.com/genshen/pkg"
+import (
+	"context"
+	"fmt"
+
+	"github.com/genshen/pkg"
+	"github.com/genshen/pkg/conf"
+)
 
 // instruction interface
 type InsInterface interface {
 	// setup the building
-	Setup() error
-	PkgPreInstall(meta *pkg.PackageMeta) (*pkg.PackageEnvs, error)
-	PkgPostInstall(meta *pkg.PackageMeta) error
+	Setup(ctx context.Context) error
+	PkgPreInstall(ctx context.Context, meta *pkg.PackageMeta) (*pkg.PackageEnvs, error)
+	PkgPostInstall(ctx context.Context, meta *pkg.PackageMeta) error
 	// files copy
-	InsCp(triple pkg.InsTriple, meta *pkg.PackageMeta) error
+	InsCp(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error
 	// run a command
-	InsRun(triple pkg.InsTriple, meta *pkg.PackageMeta) error
+	InsRun(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error
 	// run cmake build
-	InsCMake(triple pkg.InsTriple, meta *pkg.PackageMeta) error
-	InsAutoPkg(triple pkg.InsTriple, meta *pkg.PackageMeta) error
+	InsCMake(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error
+	InsAutoPkg(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error
+	// run autotools (configure, make and make install) build
+	InsAutotools(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error
+	// run meson build
+	InsMeson(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error
+	// run make build with a copy of source
+	InsMake(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error
+	// set environment variable for later instructions of the package
+	InsEnv(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error
+	// create a directory
+	InsMkdir(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error
+	// remove a file or directory
+	InsRm(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error
+	// apply a patch to package source
+	InsPatch(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error
+	// download a file
+	InsDownload(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error
 }
 
 // base instruction
 type BaseInsExecutor struct {
 	cmakeConfigArg string
 	cmakeBuildArg  string
-	nJobs          int32 // N jobs for building
+	nJobs          int32       // N jobs for building
+	config         buildConfig // build config of packages
+}
+
+// buildConfig is a configuration for building packages,
+// packages of each config are built in its own build trees and installed to its own install prefix.
+type buildConfig struct {
+	buildType   string       // cmake build type, e.g. Release, Debug
+	profileName string       // name of the toolchain profile, empty for no profile
+	profile     conf.Profile // toolchain profile from pkg.config.yaml
+	generator   string       // cmake generator, empty for the default generator of cmake
+}
+
+// generatorName returns the cmake generator for logging.
+func (c buildConfig) generatorName() string {
+	if c.generator == "" {
+		return "the default generator"
+	}
+	return c.generator
+}
+
+// cmakeGeneratorArg returns the cmake configuration argument for selecting generator (with a trailing space).
+func (c buildConfig) cmakeGeneratorArg() string {
+	if c.generator == "" {
+		return ""
+	}
+	return fmt.Sprintf("-G \"%s\" ", c.generator)
+}
+
+// name of the build config, used in directory names (e.g. vendor/cache/@pkg/@config).
+// It is @profile-@buildType if a profile is used.
+func (c buildConfig) name() string {
+	if c.profileName != "" {
+		return c.profileName + "-" + c.buildType
+	}
+	return c.buildType
+}
+
+// environ returns the environment variables of building commands set by the profile.
+func (c buildConfig) environ() []string {
+	if c.profileName == "" {
+		return nil
+	}
+	return append(c.profile.Environ(), "PKG_PROFILE="+c.profileName)
+}
+
+// setEnvs sets the variables depending on the build config.
+func (c buildConfig) setEnvs(envs *pkg.PackageEnvs) {
+	envs.SetBuildConfig(c.name(), c.buildType)
 }
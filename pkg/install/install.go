@@ -2,13 +2,19 @@ package install
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/genshen/cmds"
 	"github.com/genshen/pkg"
+	"github.com/genshen/pkg/conf"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -32,12 +38,28 @@ func init() {
 	buildCommand.FlagSet = fs
 	buildCommand.FlagSet.StringVar(&cmd.PkgHome, "p", pwd, "absolute or relative path for pkg home.")
 	buildCommand.FlagSet.StringVar(&cmd.PkgName, "pkg", "", "install a specific package, default is all packages.")
-	buildCommand.FlagSet.BoolVar(&cmd.sh, "sh", false, "skip building, but generate shell script for building packages.")
+	buildCommand.FlagSet.BoolVar(&cmd.sh, "sh", false, "skip building, but generate shell script for building packages (the same as `-emit sh`).")
+	buildCommand.FlagSet.StringVar(&cmd.emit, "emit", "", "skip building, but generate a build file for building packages: sh (a sequential shell script) or make (a Makefile building independent packages in parallel by `make -j`, and resuming after a failure).")
+	buildCommand.FlagSet.BoolVar(&cmd.dryRun, "dry-run", false, "skip building, but print the build plan: package order, expanded instructions, commands and packages skipped by up-to-date checks.")
+	buildCommand.FlagSet.StringVar(&cmd.format, "format", PlanFormatText, "output format of the build plan in dry-run mode: text or json.")
 	buildCommand.FlagSet.BoolVar(&cmd.self, "self", false, "only build the package specified by `pkg` option(not build dependency packages)")
 	buildCommand.FlagSet.IntVar(&cmd.nJobs, "j", 1, "number of parallel jobs at once while package building.")
+	buildCommand.FlagSet.IntVar(&cmd.nPkgJobs, "jobs-packages", 1, "number of packages built concurrently. Packages are scheduled in the order of dependency graph.")
+	buildCommand.FlagSet.BoolVar(&cmd.keepGoing, "keep-going", false, "keep building other packages (not depending on the failed package) and other build configs after a package failed. A summary of all packages is printed at the end.")
+	buildCommand.FlagSet.IntVar(&cmd.logLines, "log-lines", 20, "number of lines of the log printed when a package failed to build (logs are saved in directory vendor/logs).")
+	buildCommand.FlagSet.DurationVar(&cmd.timeout, "timeout", 0, "timeout of the whole installation, e.g. 2h. Running commands are killed on timeout (or on SIGINT/SIGTERM). 0 for no timeout.")
+	buildCommand.FlagSet.DurationVar(&cmd.insTimeout, "ins-timeout", 0, "timeout of each instruction of packages, e.g. 30m. 0 for no timeout.")
+	buildCommand.FlagSet.BoolVar(&cmd.force, "force", false, "build all packages, even if they are up-to-date.")
+	buildCommand.FlagSet.StringVar(&cmd.forcePkgs, "force-pkg", "", "comma separated list of packages to be built even if they are up-to-date. Packages depending on them are also rebuilt.")
+	buildCommand.FlagSet.BoolVar(&cmd.artifactCache, "artifact-cache", true, "restore installed packages from the artifact cache in $HOME/"+pkg.VendorUserHome+"/"+pkg.VendorUserHomeArtifacts+" if the sources, instructions and build config are the same, and save built packages to it.")
+	buildCommand.FlagSet.StringVar(&cmd.buildType, "build-type", "", "cmake build type (CMAKE_BUILD_TYPE) of packages, e.g. Release, Debug. Packages of non-Release build type are installed to vendor/pkg-<build type>. (default: build type of the profile, or "+pkg.DefaultBuildType+")")
+	buildCommand.FlagSet.StringVar(&cmd.configs, "configs", "", "comma separated list of build types to be built one by one, e.g. Debug,Release. It overrides the `build-type` option.")
+	buildCommand.FlagSet.StringVar(&cmd.profileName, "profile", "", "name of the toolchain profile defined in "+conf.ConfigFileName+" (compilers, toolchain file, cmake arguments and env). Packages of a profile are installed to vendor/pkg-<profile>-<build type>.")
+	buildCommand.FlagSet.StringVar(&cmd.cmakeGenerator, "cmake-generator", cmakeGeneratorAuto, "cmake generator, e.g. Ninja, \"Unix Makefiles\". \""+cmakeGeneratorAuto+"\" uses Ninja if it is found in PATH, empty string uses the default generator of cmake.")
 	buildCommand.FlagSet.StringVar(&cmd.cmakeConfigArg, "cmake-conf-arg", "", "arguments used in cmake configuration step.")
 	buildCommand.FlagSet.StringVar(&cmd.cmakeBuildArg, "cmake-build-arg", "", "arguments used in cmake building step.")
 	buildCommand.FlagSet.BoolVar(&cmd.verbose, "verbose", false, "show building logs while installing package(s).")
+	buildCommand.FlagSet.Var(&cmd.args, "arg", "override value of an arg resolved by `fetch`, format: KEY=VALUE. It can be used multiple times.")
 
 	buildCommand.FlagSet.Usage = buildCommand.Usage // use default usage provided by cmds.Command.
 	buildCommand.Runner = &cmd
@@ -47,12 +69,29 @@ func init() {
 type install struct {
 	PkgHome        string
 	PkgName        string
-	sh             bool   // generate shell script for building packages(sh)
-	self           bool   // not build build dependency packages.
-	verbose        bool   // log the building log (verbose)
-	nJobs          int    // number of parallel jobs at once while package building
-	cmakeConfigArg string // config argument while installation
-	cmakeBuildArg  string // build argument while installation
+	sh             bool          // generate shell script for building packages(sh)
+	emit           string        // format of the generated build file: sh or make
+	dryRun         bool          // print the build plan only
+	format         string        // output format of the build plan
+	self           bool          // not build build dependency packages.
+	verbose        bool          // log the building log (verbose)
+	nJobs          int           // number of parallel jobs at once while package building
+	nPkgJobs       int           // number of packages built concurrently
+	keepGoing      bool          // keep building other packages after a failure
+	logLines       int           // number of log lines printed on failure
+	timeout        time.Duration // timeout of the whole installation
+	insTimeout     time.Duration // timeout of each instruction
+	force          bool          // build all packages, ignoring stamps
+	forcePkgs      string        // packages to be built, ignoring stamps
+	artifactCache  bool          // use the artifact cache
+	buildType      string        // cmake build type
+	configs        string        // build types to be built
+	profileName    string        // name of toolchain profile
+	profile        conf.Profile  // toolchain profile
+	cmakeGenerator string        // cmake generator
+	cmakeConfigArg string        // config argument while installation
+	cmakeBuildArg  string        // build argument while installation
+	args           pkg.ArgValues // args overriding the args recorded in sum file
 	Metas          map[string]pkg.PackageMeta
 }
 
@@ -60,6 +99,18 @@ func (b *install) PreRun() error {
 	if b.PkgHome == "" {
 		return errors.New("flag p is required")
 	}
+	if b.format != PlanFormatText && b.format != PlanFormatJson {
+		return fmt.Errorf("unsupported plan format `%s`", b.format)
+	}
+	if b.sh {
+		b.emit = EmitShell
+	}
+	if b.emit != "" && b.emit != EmitShell && b.emit != EmitMakefile {
+		return fmt.Errorf("unsupported build file format `%s`", b.emit)
+	}
+	if b.dryRun && b.emit != "" {
+		return errors.New("flag dry-run and emit (or sh) can not be used together")
+	}
 	// check sum file
 	pkgSumPath := pkg.GetPkgSumPath(b.PkgHome)
 	if fileInfo, err := os.Stat(pkgSumPath); err != nil {
@@ -77,9 +128,85 @@ func (b *install) PreRun() error {
 	if err := pkg.DepTreeRecover(&b.Metas, pkgSumPath); err != nil {
 		return err
 	}
+
+	// load toolchain profile
+	if b.profileName != "" {
+		if config, err := conf.ParseConfig(b.PkgHome); err != nil {
+			return err
+		} else if profile, err := config.FindProfile(b.profileName, b.PkgHome); err != nil {
+			return err
+		} else {
+			b.profile = profile
+		}
+	}
+	if b.cmakeGenerator == cmakeGeneratorAuto {
+		b.cmakeGenerator = detectCMakeGenerator()
+	}
+	if b.buildType == "" {
+		b.buildType = pkg.DefaultBuildType
+		if b.profile.BuildType != "" {
+			b.buildType = b.profile.BuildType
+		}
+	}
+	prefixes := make(map[string]string)
+	for _, config := range b.buildConfigs() {
+		if config.buildType == "" || strings.ContainsAny(config.buildType, "/\\ ") {
+			return fmt.Errorf("invalid build type `%s`", config.buildType)
+		}
+		// build types only differing in case share the same install prefix.
+		prefix := pkg.PkgPrefixDirName(config.name())
+		if other, ok := prefixes[prefix]; ok {
+			return fmt.Errorf("build types `%s` and `%s` are the same config", other, config.buildType)
+		}
+		prefixes[prefix] = config.buildType
+	}
+
+	// override args resolved in fetching.
+	if len(b.args) != 0 {
+		declared := make(map[string]bool)
+		for name, meta := range b.Metas {
+			for k := range meta.Args {
+				declared[k] = true
+			}
+			meta.Args = pkg.ResolveArgs(meta.Args, b.args)
+			b.Metas[name] = meta
+		}
+		for k := range b.args {
+			if !declared[k] {
+				log.WithFields(log.Fields{"arg": k}).Warning("arg is not declared in any package, it is ignored.")
+			}
+		}
+	}
 	return nil
 }
 
+// buildConfigs returns the build configs specified by the `configs` or `build-type` option.
+func (b *install) buildConfigs() []buildConfig {
+	buildTypes := []string{b.buildType}
+	if b.configs != "" {
+		buildTypes = strings.Split(b.configs, ",")
+	}
+	configs := make([]buildConfig, 0, len(buildTypes))
+	for _, buildType := range buildTypes {
+		configs = append(configs, buildConfig{buildType: normalizeBuildType(strings.TrimSpace(buildType)), profileName: b.profileName, profile: b.profile, generator: b.cmakeGenerator})
+	}
+	return configs
+}
+
+// cmakeBuildTypes are the build types known by cmake.
+var cmakeBuildTypes = []string{"Debug", "Release", "RelWithDebInfo", "MinSizeRel"}
+
+// normalizeBuildType returns the build type in the case used by cmake if it is a known build type (e.g. debug -> Debug),
+// thus stamps and manifests of a build config are not saved under different names.
+func normalizeBuildType(buildType string) string {
+	for _, known := range cmakeBuildTypes {
+		if strings.EqualFold(buildType, known) {
+			return known
+		}
+	}
+	return buildType
+}
+
 func (b *install) Run() error {
 	// compile and install the source code.
 	// besides, you can also just use source code in your project (e.g. use cmake package in cmake project).
@@ -88,12 +215,16 @@ func (b *install) Run() error {
 		Metas map[string]pkg.PackageMeta
 	}{nil, b.Metas}
 
+	graph, err := pkg.LoadGraph(pkg.GetDepGraphPath(b.PkgHome))
+	if err != nil {
+		return err
+	}
 	if b.PkgName != "" { // build a specific package, not all packages.
 		if b.self { // only build one package
 			options.lists = make([]string, 0, 1)
 			options.lists = append(options.lists, b.PkgName)
 		} else { // also build its dependencies.
-			if pkgLists, err := pkg.LoadListFromGraph(pkg.GetDepGraphPath(b.PkgHome), b.PkgName); err != nil {
+			if pkgLists, err := graph.ListDeps(b.PkgName); err != nil {
 				return err
 			} else {
 				options.lists = pkgLists
@@ -103,33 +234,112 @@ func (b *install) Run() error {
 	} else {
 		// set default building packages if PkgName is not specified.
 		b.PkgName = pkg.RootPKG
-		if pkgLists, err := pkg.LoadListFromGraph(pkg.GetDepGraphPath(b.PkgHome), b.PkgName); err != nil {
+		if pkgLists, err := graph.ListDeps(b.PkgName); err != nil {
 			return err
 		} else {
 			options.lists = pkgLists
 		}
 	}
+	buildOpts := buildOptions{jobs: b.nPkgJobs, keepGoing: b.keepGoing, deps: graph.DirectDeps(), timeout: b.insTimeout}
 
-	if b.sh {
+	// running commands are killed on SIGINT/SIGTERM or timeout.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+
+	var forcePkgs []string
+	if b.forcePkgs != "" {
+		forcePkgs = strings.Split(b.forcePkgs, ",")
+	}
+	salt := fmt.Sprintf("cmake-conf-arg: %s\ncmake-build-arg: %s\nPKG_INNER_BUILD: %s", b.cmakeConfigArg, b.cmakeBuildArg, os.Getenv("PKG_INNER_BUILD"))
+
+	if b.dryRun {
+		var plan buildPlan
+		buildOpts.jobs = 1 // packages are planned in building order.
+		for _, config := range b.buildConfigs() {
+			planner := newInsPlanner(b.PkgHome, int32(b.nJobs), b.cmakeConfigArg, b.cmakeBuildArg, config, options.Metas)
+			buildOpts.stamps = newStampChecker(b.PkgHome, config, salt, b.force, forcePkgs)
+			buildOpts.stamps.dryRun = true
+			if err := buildPkg(ctx, planner, options.lists, options.Metas, buildOpts); err != nil {
+				return err
+			}
+			plan.Configs = append(plan.Configs, planner.plan(options.lists))
+		}
+		return plan.write(os.Stdout, b.format)
+	} else if b.emit == EmitMakefile {
+		if makefile, err := os.Create(pkg.GetPkgBuildMakefilePath(b.PkgHome)); err != nil {
+			return err
+		} else {
+			defer makefile.Close()
+			mkWriter := NewInsMakefileWriter(b.PkgHome, bufio.NewWriter(makefile), int32(b.nJobs), b.cmakeConfigArg, b.cmakeBuildArg, b.buildConfigs()[0], buildOpts.deps)
+			buildOpts.jobs = 1 // the Makefile is written sequentially.
+			for _, config := range b.buildConfigs() {
+				if err := mkWriter.setConfig(config); err != nil {
+					return err
+				}
+				if err := buildPkg(ctx, mkWriter, options.lists, options.Metas, buildOpts); err != nil {
+					return err
+				}
+			}
+			if err := mkWriter.finish(); err != nil {
+				return err
+			}
+			log.Infof("pkg building Makefile generated at %s, build packages by: %s", pkg.GetPkgBuildMakefilePath(b.PkgHome), mkWriter.command())
+		}
+	} else if b.emit == EmitShell {
 		if shellFile, err := os.OpenFile(pkg.GetPkgBuildPath(b.PkgHome), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755); err != nil {
 			return err
 		} else {
 			buffWriter := bufio.NewWriter(shellFile)
 			defer buffWriter.Flush()
-			shWriter, err := NewInsShellWriter(b.PkgHome, buffWriter, int32(b.nJobs), b.cmakeConfigArg, b.cmakeBuildArg)
+			shWriter, err := NewInsShellWriter(b.PkgHome, buffWriter, int32(b.nJobs), b.cmakeConfigArg, b.cmakeBuildArg, b.buildConfigs()[0])
 			if err != nil {
 				return err
 			}
-			if err := buildPkg(shWriter, options.lists, options.Metas); err != nil {
-				return err
+			buildOpts.jobs = 1 // the shell script is written sequentially.
+			for _, config := range b.buildConfigs() {
+				shWriter.setConfig(config)
+				if err := buildPkg(ctx, shWriter, options.lists, options.Metas, buildOpts); err != nil {
+					return err
+				}
 			}
 
 			log.Info("pkg building shell script generated at ", pkg.GetPkgBuildPath(b.PkgHome))
 		}
 	} else {
-		var insExe = NewInsExecutor(b.PkgHome, b.verbose, int32(b.nJobs), b.cmakeConfigArg, b.cmakeBuildArg)
-		if err := buildPkg(insExe, options.lists, options.Metas); err != nil {
-			return err
+		var buildErrs []error // with keep-going, other build configs are still built after a failure.
+		for _, config := range b.buildConfigs() {
+			log.WithFields(log.Fields{"config": config.name()}).Info("building packages.")
+			var insExe = NewInsExecutor(b.PkgHome, b.verbose, int32(b.nJobs), b.cmakeConfigArg, b.cmakeBuildArg, config)
+			buildOpts.stamps = newStampChecker(b.PkgHome, config, salt, b.force, forcePkgs)
+			if b.artifactCache {
+				if buildOpts.artifacts, err = newArtifactCache(b.PkgHome, config, salt); err != nil {
+					return err
+				}
+			}
+			buildOpts.report = newBuildReport(options.lists)
+			err := buildPkg(ctx, insExe, options.lists, options.Metas, buildOpts)
+			for _, cmdErr := range CommandErrors(err) {
+				fmt.Fprintf(os.Stderr, "\n%s", cmdErr.Summary(b.logLines))
+			}
+			if writeErr := buildOpts.report.write(os.Stderr, config.name()); writeErr != nil {
+				return writeErr
+			}
+			if failed := buildOpts.report.failed(); len(failed) != 0 {
+				buildErrs = append(buildErrs, fmt.Errorf("config %s: failed to build packages: %s", config.name(), strings.Join(failed, ", ")))
+			} else if err != nil {
+				buildErrs = append(buildErrs, fmt.Errorf("config %s: %w", config.name(), err))
+			}
+			if len(buildErrs) != 0 && (!b.keepGoing || ctx.Err() != nil) {
+				return errors.Join(buildErrs...)
+			}
+		}
+		if len(buildErrs) != 0 {
+			return errors.Join(buildErrs...) // exit with non-zero code
 		}
 		log.Info("all packages installed successfully.")
 	}
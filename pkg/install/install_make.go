@@ -0,0 +1,286 @@
+package install
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/genshen/pkg"
+)
+
+const (
+	EmitShell    = "sh"
+	EmitMakefile = "make"
+)
+
+// InsMakefileWriter writes instructions as a Makefile.
+// Each instruction of a package is a step, the commands of the step (generated by InsShellWriter) are saved
+// to a script in vendor/scripts/@config/@pkg, and a stamp file is touched after the step succeeded.
+// A package target depends on the targets of its dependencies, thus `make -j` builds independent packages in parallel,
+// and resumes from the failed step after a failure.
+// Paths in the Makefile are relative to the vendor directory, thus the project path can contain special characters
+// of make (e.g. spaces), and the Makefile must be run in the vendor directory: make -C vendor -f pkg.build.mk.
+type InsMakefileWriter struct {
+	*InsShellWriter
+	buf      bytes.Buffer        // commands generated by shell writer
+	makefile *bufio.Writer       // Makefile writer
+	deps     map[string][]string // direct dependencies of each package
+	written  map[string]bool     // packages written in current build config
+	configs  []string            // phony targets of build configs
+	targets  []string            // package targets of current build config (paths are not escaped)
+	started  bool                // the Makefile head is written
+
+	// states of current package
+	exports  string // environment variables set by ENV instructions
+	steps    int    // number of steps
+	lastStep string // stamp of the last step (not escaped)
+}
+
+func NewInsMakefileWriter(pkgHome string, w *bufio.Writer, nJobs int32, cmakeConfigArg, cmakeBuildArg string, config buildConfig, deps map[string][]string) *InsMakefileWriter {
+	mk := InsMakefileWriter{makefile: w, deps: deps, written: make(map[string]bool)}
+	mk.InsShellWriter, _ = NewInsShellWriter(pkgHome, bufio.NewWriter(&mk.buf), nJobs, cmakeConfigArg, cmakeBuildArg, config)
+	return &mk
+}
+
+func (mk *InsMakefileWriter) Setup(ctx context.Context) error {
+	if mk.started {
+		return nil
+	}
+	mk.started = true
+	_, err := mk.makefile.WriteString(fmt.Sprintf("# generated by pkg, build packages by: %s\n.DEFAULT_GOAL := all\n"+
+		"ifeq ($(wildcard %s),)\n$(error the Makefile must be run in its directory, e.g. make -C vendor -f %s)\nendif\n",
+		mk.command(), pkg.BuildMakefileName, pkg.BuildMakefileName))
+	return err
+}
+
+// command returns the command to run the Makefile.
+func (mk *InsMakefileWriter) command() string {
+	return fmt.Sprintf("make -C %s -f %s -j", shellQuote(pkg.GetVendorPath(mk.pkgHome)), pkg.BuildMakefileName)
+}
+
+// setConfig changes the build config of the following packages.
+// The phony target of the last build config is written.
+func (mk *InsMakefileWriter) setConfig(config buildConfig) error {
+	if err := mk.writeConfigTarget(); err != nil {
+		return err
+	}
+	mk.InsShellWriter.setConfig(config)
+	return nil
+}
+
+func (mk *InsMakefileWriter) writeConfigTarget() error {
+	if len(mk.targets) == 0 {
+		return nil
+	}
+	name := mkEscape(mk.config.name())
+	mk.configs = append(mk.configs, name)
+	_, err := mk.makefile.WriteString(fmt.Sprintf("\n.PHONY: %s\n%s: %s\n", name, name, mkJoin(mk.targets)))
+	mk.targets = nil
+	mk.written = make(map[string]bool)
+	return err
+}
+
+// finish writes the targets of build configs and the default target.
+func (mk *InsMakefileWriter) finish() error {
+	if err := mk.writeConfigTarget(); err != nil {
+		return err
+	}
+	if _, err := mk.makefile.WriteString(fmt.Sprintf("\n.PHONY: all\nall: %s\n", strings.Join(mk.configs, " "))); err != nil {
+		return err
+	}
+	return mk.makefile.Flush()
+}
+
+// stampPath returns path (relative to vendor) of the stamp file of a package (step is empty) or a step of the package.
+func (mk *InsMakefileWriter) stampPath(packageName, step string) string {
+	dir := path.Join(pkg.VendorStamps, EmitMakefile, mk.config.name())
+	if step == "" {
+		return path.Join(dir, packageName+".stamp")
+	}
+	return path.Join(dir, packageName, step+".stamp")
+}
+
+func (mk *InsMakefileWriter) PkgPreInstall(ctx context.Context, meta *pkg.PackageMeta) (*pkg.PackageEnvs, error) {
+	envs, err := mk.InsShellWriter.PkgPreInstall(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+	mk.writer.Flush()
+	mk.buf.Reset() // drop the package head written by shell writer.
+	mk.exports, mk.steps, mk.lastStep = "", 0, ""
+	return envs, nil
+}
+
+func (mk *InsMakefileWriter) PkgPostInstall(ctx context.Context, meta *pkg.PackageMeta) error {
+	target := mk.stampPath(meta.PackageName, "")
+	prerequisites := mk.depTargets(meta.PackageName)
+	if mk.lastStep != "" {
+		prerequisites = append(prerequisites, mk.lastStep)
+	}
+	if _, err := mk.makefile.WriteString(fmt.Sprintf("\n%s: %s\n%s", mkEscape(target), mkJoin(prerequisites), mkTouch(target))); err != nil {
+		return err
+	}
+	mk.targets = append(mk.targets, target)
+	mk.written[meta.PackageName] = true
+	return nil
+}
+
+// depTargets returns the targets of dependencies of a package written in current build config.
+func (mk *InsMakefileWriter) depTargets(name string) []string {
+	targets := make([]string, 0)
+	for _, dep := range mk.deps[name] {
+		if mk.written[dep] {
+			targets = append(targets, mk.stampPath(dep, ""))
+		}
+	}
+	return targets
+}
+
+// step writes an instruction as a step of the package:
+// the commands generated by shell writer are saved to a script, and a target running the script is written to Makefile.
+// The first step depends on the dependencies of the package, and the others depend on the previous step.
+// The script is only rewritten if it is changed, thus the changed step and the following steps are run again.
+func (mk *InsMakefileWriter) step(ctx context.Context, verb string, triple pkg.InsTriple, meta *pkg.PackageMeta, fn func(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error) error {
+	if err := fn(ctx, triple, meta); err != nil {
+		return err
+	}
+	if err := mk.writer.Flush(); err != nil {
+		return err
+	}
+	commands := mk.buf.String()
+	mk.buf.Reset()
+	if verb == pkg.InsEnv { // variables are exported in the scripts of following steps.
+		mk.exports += commands
+		return nil
+	}
+
+	head, err := mk.scriptHead(ctx)
+	if err != nil {
+		return err
+	}
+	mk.steps++
+	name := fmt.Sprintf("%02d-%s", mk.steps, strings.ToLower(verb))
+	script := filepath.Join(pkg.GetPackageScriptPath(mk.pkgHome, mk.config.name(), meta.PackageName), name+".sh")
+	if err := writeFileIfChanged(script, []byte(head+mk.exports+commands), 0755); err != nil {
+		return err
+	}
+	if script, err = filepath.Rel(pkg.GetVendorPath(mk.pkgHome), script); err != nil {
+		return err
+	}
+	script = filepath.ToSlash(script)
+
+	prerequisites := []string{mk.lastStep}
+	if mk.lastStep == "" {
+		prerequisites = mk.depTargets(meta.PackageName)
+	}
+	target := mk.stampPath(meta.PackageName, name)
+	if _, err := mk.makefile.WriteString(fmt.Sprintf("\n%s: %s\n\t@echo %s\n\tsh %s\n%s",
+		mkEscape(target), mkJoin(append(prerequisites, script)), mkRecipe(shellQuote("["+meta.PackageName+"] "+name)),
+		mkRecipe(shellQuote(script)), mkTouch(target))); err != nil {
+		return err
+	}
+	mk.lastStep = target
+	return nil
+}
+
+// scriptHead returns the head of scripts: variables of project paths and build config.
+func (mk *InsMakefileWriter) scriptHead(ctx context.Context) (string, error) {
+	mk.headWritten = false
+	if err := mk.InsShellWriter.Setup(ctx); err != nil {
+		return "", err
+	}
+	if err := mk.writer.Flush(); err != nil {
+		return "", err
+	}
+	head := mk.buf.String()
+	mk.buf.Reset()
+	return head, nil
+}
+
+func (mk *InsMakefileWriter) InsCp(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return mk.step(ctx, pkg.InsCp, triple, meta, mk.InsShellWriter.InsCp)
+}
+
+func (mk *InsMakefileWriter) InsRun(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return mk.step(ctx, pkg.InsRun, triple, meta, mk.InsShellWriter.InsRun)
+}
+
+func (mk *InsMakefileWriter) InsCMake(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return mk.step(ctx, pkg.InsCmake, triple, meta, mk.InsShellWriter.InsCMake)
+}
+
+func (mk *InsMakefileWriter) InsAutoPkg(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return mk.step(ctx, pkg.InsAutoPkg, triple, meta, mk.InsShellWriter.InsAutoPkg)
+}
+
+func (mk *InsMakefileWriter) InsAutotools(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return mk.step(ctx, pkg.InsAutotools, triple, meta, mk.InsShellWriter.InsAutotools)
+}
+
+func (mk *InsMakefileWriter) InsMeson(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return mk.step(ctx, pkg.InsMeson, triple, meta, mk.InsShellWriter.InsMeson)
+}
+
+func (mk *InsMakefileWriter) InsMake(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return mk.step(ctx, pkg.InsMake, triple, meta, mk.InsShellWriter.InsMake)
+}
+
+func (mk *InsMakefileWriter) InsEnv(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return mk.step(ctx, pkg.InsEnv, triple, meta, mk.InsShellWriter.InsEnv)
+}
+
+func (mk *InsMakefileWriter) InsMkdir(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return mk.step(ctx, pkg.InsMkdir, triple, meta, mk.InsShellWriter.InsMkdir)
+}
+
+func (mk *InsMakefileWriter) InsRm(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return mk.step(ctx, pkg.InsRm, triple, meta, mk.InsShellWriter.InsRm)
+}
+
+func (mk *InsMakefileWriter) InsPatch(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return mk.step(ctx, pkg.InsPatch, triple, meta, mk.InsShellWriter.InsPatch)
+}
+
+func (mk *InsMakefileWriter) InsDownload(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return mk.step(ctx, pkg.InsDownload, triple, meta, mk.InsShellWriter.InsDownload)
+}
+
+// mkEscape escapes a path used as a target or prerequisite in Makefile.
+func mkEscape(s string) string {
+	return strings.NewReplacer("$", "$$", " ", "\\ ", "#", "\\#", ":", "\\:").Replace(s)
+}
+
+// mkJoin escapes and joins paths as prerequisites.
+func mkJoin(paths []string) string {
+	escaped := make([]string, 0, len(paths))
+	for _, p := range paths {
+		escaped = append(escaped, mkEscape(p))
+	}
+	return strings.Join(escaped, " ")
+}
+
+// mkRecipe escapes `$` in a shell command used as a recipe line in Makefile.
+func mkRecipe(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
+
+// mkTouch returns the recipe lines to touch the stamp file target.
+func mkTouch(target string) string {
+	return fmt.Sprintf("\t@mkdir -p %s\n\t@touch %s\n", mkRecipe(shellQuote(path.Dir(target))), mkRecipe(shellQuote(target)))
+}
+
+// writeFileIfChanged writes the file only if its content is changed, thus its modification time is kept otherwise.
+func writeFileIfChanged(path string, content []byte, perm os.FileMode) error {
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, content) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, perm)
+}
@@ -0,0 +1,85 @@
+package install
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/genshen/pkg"
+)
+
+func TestInsMakefileWriter(t *testing.T) {
+	if _, err := exec.LookPath("make"); err != nil {
+		t.Skip("make is not found")
+	}
+	t.Run("home", func(t *testing.T) {
+		testInsMakefileWriter(t, t.TempDir())
+	})
+	// special characters of make in the project path.
+	t.Run("home with special characters", func(t *testing.T) {
+		testInsMakefileWriter(t, filepath.Join(t.TempDir(), "my project#1:a"))
+	})
+}
+
+func testInsMakefileWriter(t *testing.T, home string) {
+	out := filepath.Join(t.TempDir(), "out")
+	metas := map[string]pkg.PackageMeta{
+		"a": {PackageName: "a", Version: "v1", SelfBuild: []string{"ENV MSG hello", "RUN " + out + " 'echo $MSG >> a.txt'"}},
+		"b": {PackageName: "b", Version: "v1", SelfBuild: []string{"RUN " + out + " 'test -f a.txt && echo b >> b.txt'"}},
+	}
+	deps := map[string][]string{"b": {"a"}}
+	lists := []string{"a", "b"}
+
+	generate := func() {
+		file, err := os.Create(pkg.GetPkgBuildMakefilePath(home))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		mk := NewInsMakefileWriter(home, bufio.NewWriter(file), 1, "", "", buildConfig{buildType: pkg.DefaultBuildType}, deps)
+		if err := mk.setConfig(buildConfig{buildType: pkg.DefaultBuildType}); err != nil {
+			t.Fatal(err)
+		}
+		if err := buildPkg(context.Background(), mk, lists, metas, buildOptions{jobs: 1, deps: deps}); err != nil {
+			t.Fatal(err)
+		}
+		if err := mk.finish(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runMake := func() {
+		if output, err := exec.Command("make", "-C", pkg.GetVendorPath(home), "-f", pkg.BuildMakefileName, "-j", "2").CombinedOutput(); err != nil {
+			t.Fatalf("make failed: %v\n%s", err, output)
+		}
+	}
+	readOut := func(name string) string {
+		content, _ := os.ReadFile(filepath.Join(out, name))
+		return string(content)
+	}
+
+	if err := os.MkdirAll(pkg.GetVendorPath(home), 0755); err != nil {
+		t.Fatal(err)
+	}
+	generate()
+	runMake()
+	if readOut("a.txt") != "hello\n" || readOut("b.txt") != "b\n" {
+		t.Fatalf("unexpected outputs: %q, %q", readOut("a.txt"), readOut("b.txt"))
+	}
+	// nothing is run again if the Makefile is regenerated without changes.
+	generate()
+	runMake()
+	if readOut("a.txt") != "hello\n" || readOut("b.txt") != "b\n" {
+		t.Fatalf("expect no steps run again, but got outputs: %q, %q", readOut("a.txt"), readOut("b.txt"))
+	}
+	// changing a step of package a runs it again, and its dependents.
+	metas["a"] = pkg.PackageMeta{PackageName: "a", Version: "v1", SelfBuild: []string{"ENV MSG world", "RUN " + out + " 'echo $MSG >> a.txt'"}}
+	generate()
+	runMake()
+	if readOut("a.txt") != "hello\nworld\n" || strings.Count(readOut("b.txt"), "b") != 2 {
+		t.Fatalf("expect changed step run again, but got outputs: %q, %q", readOut("a.txt"), readOut("b.txt"))
+	}
+}
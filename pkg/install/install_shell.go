@@ -2,6 +2,7 @@ package install
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -14,23 +15,25 @@ import (
 // writer instructions as shell format to file
 type InsShellWriter struct {
 	BaseInsExecutor
-	pkgHome string        // home directory of running pkg command
-	writer  *bufio.Writer // shell script file writer
+	pkgHome     string        // home directory of running pkg command
+	writer      *bufio.Writer // shell script file writer
+	headWritten bool          // the shell head is written, it is written only once for multiple build configs
 }
 
-func NewInsShellWriter(pkgHome string, w *bufio.Writer, nJobs int32, cmakeConfigArg, cmakeBuildArg string) (*InsShellWriter, error) {
+func NewInsShellWriter(pkgHome string, w *bufio.Writer, nJobs int32, cmakeConfigArg, cmakeBuildArg string, config buildConfig) (*InsShellWriter, error) {
 	return &InsShellWriter{
 		BaseInsExecutor: BaseInsExecutor{
 			cmakeConfigArg: cmakeConfigArg,
 			cmakeBuildArg:  cmakeBuildArg,
 			nJobs:          nJobs,
+			config:         config,
 		},
 		pkgHome: pkgHome,
 		writer:  w,
 	}, nil
 }
 
-func (sh *InsShellWriter) Setup() error {
+func (sh *InsShellWriter) Setup(ctx context.Context) error {
 	const shellHead = `#!/bin/sh
 set -e
 
@@ -39,47 +42,70 @@ PROJECT_HOME=%s
 PKG_SRC_PATH=%s
 `
 
-	pkgSrcPath := pkg.GetPkgSrcPath(sh.pkgHome)
-	if _, err := sh.writer.WriteString(fmt.Sprintf(shellHead, pkg.GetVendorPath(sh.pkgHome), sh.pkgHome, pkgSrcPath)); err != nil {
+	if !sh.headWritten {
+		pkgSrcPath := pkg.GetPkgSrcPath(sh.pkgHome)
+		if _, err := sh.writer.WriteString(fmt.Sprintf(shellHead, shellQuote(pkg.GetVendorPath(sh.pkgHome)), shellQuote(sh.pkgHome), shellQuote(pkgSrcPath))); err != nil {
+			return err
+		}
+		sh.headWritten = true
+	}
+	if _, err := sh.writer.WriteString(fmt.Sprintf("\n### build config %s\n", sh.config.name())); err != nil {
 		return err
 	}
-
+	// environment variables of the profile
+	for _, env := range sh.config.environ() {
+		kv := strings.SplitN(env, "=", 2)
+		if _, err := sh.writer.WriteString(fmt.Sprintf("export %s=%s\n", kv[0], shellQuote(kv[1]))); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (sh *InsShellWriter) PkgPreInstall(meta *pkg.PackageMeta) (*pkg.PackageEnvs, error) {
+// shellQuote quotes a string by single quotes for shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// setConfig changes the build config of the following packages.
+func (sh *InsShellWriter) setConfig(config buildConfig) {
+	sh.config = config
+}
+
+func (sh *InsShellWriter) PkgPreInstall(ctx context.Context, meta *pkg.PackageMeta) (*pkg.PackageEnvs, error) {
 	// using short path with env '$PKG_SRC_PATH'.
 	packageSrcPath := strings.Replace(meta.VendorSrcPath(sh.pkgHome), pkg.GetPkgSrcPath(sh.pkgHome), "$PKG_SRC_PATH", 1)
 	// package env
 	packageEnv := pkg.NewPackageEnvs("$PROJECT_HOME", meta.PackageName, packageSrcPath)
-	if _, err := sh.writer.WriteString(fmt.Sprintf("\n## pacakge %s\n", meta.PackageName)); err != nil {
+	sh.config.setEnvs(packageEnv)
+	packageEnv.SetPackageMeta(meta)
+	// each package is built in a subshell, thus variables set by ENV instruction only affect the package.
+	if _, err := sh.writer.WriteString(fmt.Sprintf("\n## pacakge %s\n(\n", meta.PackageName)); err != nil {
 		return nil, err
 	}
 	return packageEnv, nil
 }
 
-func (sh *InsShellWriter) PkgPostInstall(meta *pkg.PackageMeta) error {
+func (sh *InsShellWriter) PkgPostInstall(ctx context.Context, meta *pkg.PackageMeta) error {
+	if _, err := sh.writer.WriteString(")\n"); err != nil {
+		return err
+	}
 	return nil
 }
 
-func (sh *InsShellWriter) InsCp(triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+func (sh *InsShellWriter) InsCp(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
 	if triple.Second == "" || triple.Third == "" {
 		return errors.New("CP instruction must have src and des")
 	}
 
-	pathBase := "${PROJECT_HOME}"
-	srcPath := meta.VendorSrcPath(pathBase)
-	if _, err := sh.writer.WriteString(fmt.Sprintf("mkdir -p \"%s\"\n", pkg.GetIncludePath(pathBase))); err != nil {
-		return err
-	}
-	if _, err := sh.writer.WriteString(fmt.Sprintf("cp -r \"%s\" \"%s\"\n",
-		filepath.Join(srcPath, triple.Second), triple.Third)); err != nil {
+	srcPath := meta.VendorSrcPath("${PROJECT_HOME}")
+	if _, err := sh.writer.WriteString(newCopyArgs(srcPath, triple.Second, triple.Third).script()); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (sh *InsShellWriter) InsRun(triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+func (sh *InsShellWriter) InsRun(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
 	if triple.Second == "" || triple.Third == "" {
 		return errors.New("RUN instruction must be a triple")
 	}
@@ -91,7 +117,7 @@ func (sh *InsShellWriter) InsRun(triple pkg.InsTriple, meta *pkg.PackageMeta) er
 	return nil
 }
 
-func (sh *InsShellWriter) InsCMake(triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+func (sh *InsShellWriter) InsCMake(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
 	pathBase := "${PROJECT_HOME}"
 	srcPath := meta.VendorSrcPath(pathBase)
 
@@ -100,6 +126,11 @@ func (sh *InsShellWriter) InsCMake(triple pkg.InsTriple, meta *pkg.PackageMeta)
 		triple.Second = triple.Second + " " + featuresToOptions(meta.Features)
 	}
 
+	// prepare cmake config from profile
+	if profileArgs := sh.config.profile.CMakeConfigArgs(); profileArgs != "" {
+		triple.Second = triple.Second + " " + profileArgs
+	}
+
 	// prepare cmake config from cli
 	if sh.cmakeConfigArg != "" {
 		triple.Second = triple.Second + " " + sh.cmakeConfigArg
@@ -110,18 +141,33 @@ func (sh *InsShellWriter) InsCMake(triple pkg.InsTriple, meta *pkg.PackageMeta)
 		triple.Third = triple.Third + " " + sh.cmakeBuildArg
 	}
 
-	var configCmd = fmt.Sprintf("cmake -S \"%s\" -B \"%s\" -DCMAKE_BUILD_TYPE=Release -DCMAKE_INSTALL_PREFIX=\"%s\" %s",
-		srcPath, pkg.GetCachePath(pathBase, meta.PackageName),
-		pkg.GetPackagePkgPath(pathBase, meta.PackageName), triple.Second)
-	var buildCmd = fmt.Sprintf("cmake --build \"%s\" --target install %s -j %d",
-		pkg.GetCachePath(pathBase, meta.PackageName), triple.Third, sh.nJobs)
+	if !hasParallelArg(triple.Third) {
+		triple.Third = fmt.Sprintf("%s --parallel %d", triple.Third, sh.nJobs)
+	}
+
+	cacheDir := pkg.GetBuildCachePath(pathBase, sh.config.name(), meta.PackageName)
+	// remove the build tree configured by another generator.
+	// The default generator is resolved from CMAKE_GENERATOR while running the script.
+	generator := sh.config.generator
+	if generator == "" {
+		generator = "${CMAKE_GENERATOR:-Unix Makefiles}"
+	}
+	cacheFile := filepath.Join(cacheDir, cmakeCacheFile)
+	if _, err := sh.writer.WriteString(fmt.Sprintf("if [ -f \"%s\" ] && ! grep -qx \"CMAKE_GENERATOR:INTERNAL=%s\" \"%s\"; then rm -rf \"%s\"; fi\n",
+		cacheFile, generator, cacheFile, cacheDir)); err != nil {
+		return err
+	}
+	var configCmd = fmt.Sprintf("cmake -S \"%s\" -B \"%s\" %s-DCMAKE_BUILD_TYPE=%s -DCMAKE_INSTALL_PREFIX=\"%s\" %s",
+		srcPath, cacheDir, sh.config.cmakeGeneratorArg(), sh.config.buildType,
+		pkg.GetPackagePkgPathOf(pathBase, sh.config.name(), meta.PackageName), triple.Second)
+	var buildCmd = fmt.Sprintf("cmake --build \"%s\" --target install %s", cacheDir, triple.Third)
 	if _, err := sh.writer.WriteString(fmt.Sprintf("cd \"%s\"\n%s\n%s\n", pathBase, configCmd, buildCmd)); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (sh *InsShellWriter) InsAutoPkg(triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+func (sh *InsShellWriter) InsAutoPkg(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
 	// if it is auto pkg and outer build mode
 	// todo only for inner builders
 	if pkgEnvInc := os.Getenv("PKG_INNER_BUILD"); pkgEnvInc == "" {
@@ -129,7 +175,131 @@ func (sh *InsShellWriter) InsAutoPkg(triple pkg.InsTriple, meta *pkg.PackageMeta
 		triple.First = pkg.InsCmake
 		triple.Second = ""
 		triple.Third = ""
-		return sh.InsCMake(triple, meta)
+		return sh.InsCMake(ctx, triple, meta)
+	}
+	return nil
+}
+
+func (sh *InsShellWriter) InsAutotools(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return sh.writeSteps(autotoolsSteps(sh.buildDirs(meta), triple, sh.nJobs))
+}
+
+func (sh *InsShellWriter) InsMeson(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return sh.writeSteps(mesonSteps(sh.buildDirs(meta), triple, sh.nJobs, sh.config.buildType))
+}
+
+func (sh *InsShellWriter) InsMake(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	return sh.writeSteps(makeSteps(sh.buildDirs(meta), triple, sh.nJobs))
+}
+
+func (sh *InsShellWriter) buildDirs(meta *pkg.PackageMeta) buildDirs {
+	pathBase := "${PROJECT_HOME}"
+	return buildDirs{
+		src:   meta.VendorSrcPath(pathBase),
+		cache: pkg.GetBuildCachePath(pathBase, sh.config.name(), meta.PackageName),
+		pkg:   pkg.GetPackagePkgPathOf(pathBase, sh.config.name(), meta.PackageName),
+	}
+}
+
+// writeSteps writes commands generated from an instruction to the shell script.
+func (sh *InsShellWriter) writeSteps(steps []insStep) error {
+	for _, step := range steps {
+		if _, err := sh.writer.WriteString(fmt.Sprintf("mkdir -p \"%s\"\ncd \"%s\"\n%s\n",
+			step.workDir, step.workDir, step.script)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sh *InsShellWriter) InsEnv(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	if _, err := envArgs(triple); err != nil {
+		return err
+	}
+	if _, err := sh.writer.WriteString(fmt.Sprintf("export %s=%s\n", triple.Second, shellQuote(triple.Third))); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (sh *InsShellWriter) InsMkdir(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	if triple.Second == "" {
+		return errors.New("MKDIR instruction must have a path")
+	}
+	if _, err := sh.writer.WriteString(fmt.Sprintf("mkdir -p %s\n", sh.shellPath(sh.insPath(meta, triple.Second)))); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (sh *InsShellWriter) InsRm(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	if triple.Second == "" {
+		return errors.New("RM instruction must have a path")
+	}
+	path := sh.insPath(meta, triple.Second)
+	if err := checkInVendor(path, pkg.GetVendorPath(sh.pkgHome)); err != nil {
+		return err
+	}
+	if _, err := sh.writer.WriteString(fmt.Sprintf("rm -rf %s\n", sh.shellPath(path))); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (sh *InsShellWriter) InsPatch(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	patchFile, strip, err := patchArgs(triple)
+	if err != nil {
+		return err
+	}
+	srcPath := meta.VendorSrcPath("${PROJECT_HOME}")
+	return sh.writeSteps([]insStep{patchStep(srcPath, sh.shellPath(sh.insPath(meta, patchFile)), strip)})
+}
+
+func (sh *InsShellWriter) InsDownload(ctx context.Context, triple pkg.InsTriple, meta *pkg.PackageMeta) error {
+	url, dest, sum, err := downloadArgs(triple)
+	if err != nil {
+		return err
+	}
+	dest = sh.insPath(meta, dest)
+	if _, err := sh.writer.WriteString(downloadScript(url, sh.shellPath(dest), sh.shellPath(filepath.Dir(dest)), sum)); err != nil {
+		return err
 	}
 	return nil
 }
+
+// shellPathVars are shell variables of project paths, which can be the prefix of expanded paths in instructions.
+var shellPathVars = []string{"${PROJECT_HOME}", "$PROJECT_HOME", "${PKG_SRC_PATH}", "$PKG_SRC_PATH"}
+
+// insPath resolves the path used in instructions to the real path,
+// relative path is relative to the source directory of the package.
+// Only the shell variables of project paths at the beginning of path are expanded.
+func (sh *InsShellWriter) insPath(meta *pkg.PackageMeta, path string) string {
+	for _, v := range shellPathVars {
+		if path == v || strings.HasPrefix(path, v+"/") {
+			path = sh.realPath(v) + strings.TrimPrefix(path, v)
+			break
+		}
+	}
+	return insPath(meta.VendorSrcPath(sh.pkgHome), path)
+}
+
+// shellPath quotes the real path for shell, the project home in path is replaced with the shell variable.
+func (sh *InsShellWriter) shellPath(path string) string {
+	if path == sh.pkgHome {
+		return `"${PROJECT_HOME}"`
+	}
+	if rel := strings.TrimPrefix(path, sh.pkgHome+string(filepath.Separator)); rel != path {
+		return `"${PROJECT_HOME}"` + shellQuote(string(filepath.Separator)+rel)
+	}
+	return shellQuote(path)
+}
+
+// realPath replaces the shell variables of project paths in path with the real paths.
+func (sh *InsShellWriter) realPath(path string) string {
+	return strings.NewReplacer(
+		"${PROJECT_HOME}", sh.pkgHome,
+		"$PROJECT_HOME", sh.pkgHome,
+		"${PKG_SRC_PATH}", pkg.GetPkgSrcPath(sh.pkgHome),
+		"$PKG_SRC_PATH", pkg.GetPkgSrcPath(sh.pkgHome),
+	).Replace(path)
+}
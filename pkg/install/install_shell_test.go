@@ -0,0 +1,104 @@
+package install
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/genshen/pkg"
+	"github.com/genshen/pkg/conf"
+)
+
+func TestInsShellWriter_Profile(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	config := buildConfig{buildType: "Debug", profileName: "clang", profile: conf.Profile{
+		CC:            "clang",
+		CXX:           "clang++",
+		ToolchainFile: "/opt/toolchain.cmake",
+		CMakeArgs:     []string{"-DFOO=ON"},
+		Env:           map[string]string{"OPT": "it's"},
+	}, generator: "Ninja"}
+	sh, err := NewInsShellWriter("/home", w, 4, "", "", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := pkg.PackageMeta{PackageName: "foo", Version: "v1"}
+	if err := sh.Setup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := sh.InsCMake(context.Background(), pkg.InsTriple{First: pkg.InsCmake}, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	script := buf.String()
+	for _, want := range []string{
+		"export CC='clang'\n",
+		"export CXX='clang++'\n",
+		"export OPT='it'\\''s'\n",
+		"export PKG_PROFILE='clang'\n",
+		`-G "Ninja" -DCMAKE_BUILD_TYPE=Debug`,
+		`grep -qx "CMAKE_GENERATOR:INTERNAL=Ninja"`,
+		"--parallel 4\n",
+		`-DCMAKE_TOOLCHAIN_FILE="/opt/toolchain.cmake" -DFOO=ON`,
+		`-B "${PROJECT_HOME}/vendor/cache/foo/clang-Debug"`,
+		`-DCMAKE_INSTALL_PREFIX="${PROJECT_HOME}/vendor/pkg-clang-debug/foo"`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expect `%s` in script, but got:\n%s", want, script)
+		}
+	}
+}
+
+func TestInsShellWriter_Paths(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	sh, err := NewInsShellWriter("/home", w, 4, "", "", buildConfig{buildType: pkg.DefaultBuildType})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := pkg.PackageMeta{PackageName: "foo", Version: "v1"}
+	ctx := context.Background()
+	for _, triple := range []pkg.InsTriple{
+		{First: pkg.InsRm, Second: "build/$(touch x)"},
+		{First: pkg.InsMkdir, Second: "$PROJECT_HOME/vendor/cache/it's"},
+		{First: pkg.InsDownload, Second: "https://example.com/a.dat", Third: "assets/a.dat " + strings.Repeat("0", 64)},
+	} {
+		var err error
+		switch triple.First {
+		case pkg.InsRm:
+			err = sh.InsRm(ctx, triple, &meta)
+		case pkg.InsMkdir:
+			err = sh.InsMkdir(ctx, triple, &meta)
+		case pkg.InsDownload:
+			err = sh.InsDownload(ctx, triple, &meta)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// paths out of vendor directory can not be removed.
+	if err := sh.InsRm(ctx, pkg.InsTriple{First: pkg.InsRm, Second: "${PROJECT_HOME}/src"}, &meta); err == nil {
+		t.Error("expect error for removing path out of vendor directory")
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	script := buf.String()
+	for _, want := range []string{
+		`rm -rf "${PROJECT_HOME}"'/vendor/src/foo@v1/build/$(touch x)'` + "\n",
+		`mkdir -p "${PROJECT_HOME}"'/vendor/cache/it'\''s'` + "\n",
+		`curl -fL -o "${PROJECT_HOME}"'/vendor/src/foo@v1/assets/a.dat' 'https://example.com/a.dat'`,
+		`"${PROJECT_HOME}"'/vendor/src/foo@v1/assets/a.dat' | $(command -v sha256sum || echo shasum -a 256) -c -`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expect `%s` in script, but got:\n%s", want, script)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package install
+
+import (
+	"testing"
+
+	"github.com/genshen/pkg"
+)
+
+func TestBuildConfigs(t *testing.T) {
+	b := install{configs: "debug, RELEASE,Coverage"}
+	var names []string
+	for _, config := range b.buildConfigs() {
+		names = append(names, config.name())
+	}
+	if len(names) != 3 || names[0] != "Debug" || names[1] != pkg.DefaultBuildType || names[2] != "Coverage" {
+		t.Errorf("unexpected build configs: %v", names)
+	}
+	// the release build type is installed to the default prefix.
+	if prefix := pkg.PkgPrefixDirName(names[1]); prefix != pkg.VendorPkg {
+		t.Errorf("unexpected prefix of release build type: %s", prefix)
+	}
+}
@@ -0,0 +1,253 @@
+package install
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/genshen/pkg"
+	log "github.com/sirupsen/logrus"
+)
+
+// fileState is the state of a file used to find files created or modified by instructions.
+type fileState struct {
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// snapshotDir returns states of all files (not directories) in dir, keyed by path relative to vendor in slash form.
+func snapshotDir(vendor, dir string) (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(vendor, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = fileState{size: info.Size(), mode: info.Mode(), modTime: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// installRecorder records files installed by packages, and writes install manifests.
+// Files in the install prefix of a package (vendor/pkg/@pkg) all belong to the package.
+// Files in the shared directory vendor/include are found by diffing the directory before and after
+// instructions that may write to it, which run exclusively (other instructions of all packages are paused),
+// thus files are not mixed up between packages while other instructions still run in parallel.
+// Files written by other instructions are found by diffing the directory before and after the package (begin and finish).
+type installRecorder struct {
+	pkgHome  string
+	config   string
+	sharedMu sync.RWMutex // locked by instructions writing to the shared directory, and read-locked by others.
+	mu       sync.Mutex
+	shared   map[string]*sharedRecord // shared files of packages being installed
+	claimed  map[string]string        // shared files recorded by exclusive instructions, and their packages
+}
+
+type sharedRecord struct {
+	lastShared bool // the last install of the package wrote to the shared directory
+	concurrent bool // other packages were installed at the same time
+	before     map[string]fileState
+	files      map[string]bool // files recorded by exclusive instructions
+}
+
+func newInstallRecorder(pkgHome, config string) *installRecorder {
+	return &installRecorder{pkgHome: pkgHome, config: config, shared: make(map[string]*sharedRecord), claimed: make(map[string]string)}
+}
+
+// begin takes the snapshot of the shared directory before installing a package.
+// finish or abort must be called after the instructions of the package.
+func (r *installRecorder) begin(meta *pkg.PackageMeta) error {
+	before, err := snapshotDir(pkg.GetVendorPath(r.pkgHome), pkg.GetIncludePath(r.pkgHome))
+	if err != nil {
+		return err
+	}
+	record := sharedRecord{before: before, files: make(map[string]bool)}
+	if last, err := pkg.LoadManifest(pkg.GetManifestPath(r.pkgHome, r.config, meta.PackageName)); err == nil {
+		for _, file := range last.Files {
+			record.lastShared = record.lastShared || isSharedFile(file)
+		}
+	}
+	r.mu.Lock()
+	for _, other := range r.shared {
+		other.concurrent = true
+	}
+	record.concurrent = len(r.shared) != 0
+	r.shared[meta.PackageName] = &record
+	r.mu.Unlock()
+	return nil
+}
+
+// writesShared returns true if the instruction may write to the shared directory:
+// it refers to the shared directory, or it is a CP or RUN instruction of a package whose last install wrote to it.
+func (r *installRecorder) writesShared(meta *pkg.PackageMeta, triple pkg.InsTriple) bool {
+	if strings.Contains(triple.Second+" "+triple.Third, pkg.GetIncludePath(r.pkgHome)) {
+		return true
+	}
+	if triple.First != pkg.InsCp && triple.First != pkg.InsRun {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.shared[meta.PackageName]
+	return ok && record.lastShared
+}
+
+// recordIns runs the instruction by fn. If the instruction may write to the shared directory,
+// it runs exclusively and the files it writes to the shared directory are recorded.
+func (r *installRecorder) recordIns(meta *pkg.PackageMeta, triple pkg.InsTriple, fn func() error) error {
+	if !r.writesShared(meta, triple) {
+		r.sharedMu.RLock()
+		defer r.sharedMu.RUnlock()
+		return fn()
+	}
+	r.sharedMu.Lock()
+	defer r.sharedMu.Unlock()
+	vendor := pkg.GetVendorPath(r.pkgHome)
+	before, err := snapshotDir(vendor, pkg.GetIncludePath(r.pkgHome))
+	if err != nil {
+		return err
+	}
+	fnErr := fn()
+	// files are recorded even if fn fails, thus they can be uninstalled.
+	after, err := snapshotDir(vendor, pkg.GetIncludePath(r.pkgHome))
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for file, state := range after {
+		if old, ok := before[file]; !ok || old != state {
+			if record, ok := r.shared[meta.PackageName]; ok {
+				record.files[file] = true
+			}
+			r.claimed[file] = meta.PackageName
+		}
+	}
+	return fnErr
+}
+
+// end returns files created or modified in the shared directory by the package since begin.
+// Files recorded by exclusive instructions of other packages are excluded.
+// Nil is returned if begin is not called for the package, e.g. the package is restored from the cache.
+func (r *installRecorder) end(name string) (map[string]bool, error) {
+	r.mu.Lock()
+	record, ok := r.shared[name]
+	delete(r.shared, name)
+	r.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	after, err := snapshotDir(pkg.GetVendorPath(r.pkgHome), pkg.GetIncludePath(r.pkgHome))
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	files := record.files
+	unexpected := false
+	for file, state := range after {
+		if old, ok := record.before[file]; ok && old == state || files[file] {
+			continue
+		}
+		if owner, ok := r.claimed[file]; ok && owner != name {
+			continue
+		}
+		files[file] = true
+		unexpected = true
+	}
+	if unexpected && record.concurrent {
+		log.WithFields(log.Fields{"pkg": name}).Warning("package wrote to shared include directory while other packages were being installed, files may be recorded to other packages.")
+	}
+	return files, nil
+}
+
+// abort drops the records of a package if it failed to install.
+func (r *installRecorder) abort(name string) {
+	r.mu.Lock()
+	delete(r.shared, name)
+	r.mu.Unlock()
+}
+
+// finish writes the install manifest of a package after it is installed.
+// Shared files recorded in the last manifest are kept if they still exist,
+// because copying a file with the same content and modification time is not detected as a change.
+// A warning is logged if a shared file is also installed by another package.
+func (r *installRecorder) finish(meta *pkg.PackageMeta) error {
+	vendor := pkg.GetVendorPath(r.pkgHome)
+	files, err := r.end(meta.PackageName)
+	if err != nil {
+		return err
+	} else if files == nil {
+		files = make(map[string]bool)
+	}
+	prefixFiles, err := snapshotDir(vendor, pkg.GetPackagePkgPathOf(r.pkgHome, r.config, meta.PackageName))
+	if err != nil {
+		return err
+	}
+	for file := range prefixFiles {
+		files[file] = true
+	}
+
+	manifestPath := pkg.GetManifestPath(r.pkgHome, r.config, meta.PackageName)
+	if last, err := pkg.LoadManifest(manifestPath); err == nil {
+		for _, file := range last.Files {
+			if isSharedFile(file) {
+				if _, err := os.Stat(filepath.Join(vendor, filepath.FromSlash(file))); err == nil {
+					files[file] = true
+				}
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// check files in shared directory installed by other packages.
+	if manifests, err := pkg.LoadManifests(r.pkgHome); err != nil {
+		return err
+	} else {
+		for _, other := range manifests {
+			if other.Package == meta.PackageName {
+				continue
+			}
+			for _, file := range other.Files {
+				if isSharedFile(file) && files[file] {
+					log.WithFields(log.Fields{
+						"pkg":   meta.PackageName,
+						"file":  file,
+						"other": other.Package,
+					}).Warning("file in shared include directory is also installed by another package.")
+				}
+			}
+		}
+	}
+
+	manifest := pkg.InstallManifest{Package: meta.PackageName, Version: meta.Version, Config: r.config, Files: make([]string, 0, len(files))}
+	for file := range files {
+		manifest.Files = append(manifest.Files, file)
+	}
+	return manifest.Save(manifestPath)
+}
+
+// isSharedFile returns true if the file (relative to vendor) is in the shared include directory.
+func isSharedFile(file string) bool {
+	return strings.HasPrefix(path.Clean(file), pkg.VendorInclude+"/")
+}
@@ -0,0 +1,149 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/genshen/pkg"
+)
+
+func TestInstallRecorder(t *testing.T) {
+	home := t.TempDir()
+	meta := pkg.PackageMeta{PackageName: "foo", Version: "v1"}
+	src := meta.VendorSrcPath(home)
+	for _, file := range []string{"include/foo.h", "lib/libfoo.a"} {
+		if err := os.MkdirAll(filepath.Join(src, filepath.Dir(file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, file), []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a file existing in shared include directory is not recorded.
+	if err := os.MkdirAll(pkg.GetIncludePath(home), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pkg.GetIncludePath(home), "other.h"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	install := func() {
+		r := newInstallRecorder(home, pkg.DefaultBuildType)
+		if err := r.begin(&meta); err != nil {
+			t.Fatal(err)
+		}
+		for _, cp := range []copyArgs{
+			newCopyArgs(src, "include/*.h", pkg.GetIncludePath(home)),
+			newCopyArgs(src, "lib/libfoo.a", filepath.Join(pkg.GetPackagePkgPathOf(home, pkg.DefaultBuildType, "foo"), "lib", "libfoo.a")),
+		} {
+			if err := cp.copy(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// files written by other instructions (e.g. RUN, CMAKE) are also recorded.
+		if err := os.WriteFile(filepath.Join(pkg.GetIncludePath(home), "foo_config.h"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.finish(&meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"include/foo.h", "include/foo_config.h", "pkg/foo/lib/libfoo.a"}
+	install()
+	if m, err := pkg.LoadManifest(pkg.GetManifestPath(home, pkg.DefaultBuildType, "foo")); err != nil || !reflect.DeepEqual(m.Files, want) {
+		t.Fatalf("unexpected manifest: %v, %v", m, err)
+	}
+	// installing again keeps the shared files, though they are unchanged.
+	install()
+	if m, err := pkg.LoadManifest(pkg.GetManifestPath(home, pkg.DefaultBuildType, "foo")); err != nil || !reflect.DeepEqual(m.Files, want) {
+		t.Fatalf("unexpected manifest after reinstalling: %v, %v", m, err)
+	}
+
+	// the package wrote shared files last time, thus its CP and RUN instructions run exclusively.
+	r := newInstallRecorder(home, pkg.DefaultBuildType)
+	if err := r.begin(&meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.recordIns(&meta, pkg.InsTriple{First: pkg.InsRun, Second: "./configure"}, func() error {
+		if r.sharedMu.TryRLock() {
+			t.Error("expect other instructions blocked while running an instruction writing shared files")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	r.abort(meta.PackageName)
+	if !r.sharedMu.TryLock() {
+		t.Error("expect lock released after the instruction")
+	}
+}
+
+func TestInstallRecorder_Overlap(t *testing.T) {
+	home := t.TempDir()
+	if err := os.MkdirAll(pkg.GetIncludePath(home), 0755); err != nil {
+		t.Fatal(err)
+	}
+	r := newInstallRecorder(home, pkg.DefaultBuildType)
+	started := make(chan string, 2)
+	install := func(name string, wait <-chan string) error {
+		meta := pkg.PackageMeta{PackageName: name}
+		if err := r.begin(&meta); err != nil {
+			return err
+		}
+		// instructions referring to the vendor directory, but not the shared include directory, can overlap.
+		cmake := pkg.InsTriple{First: pkg.InsCmake, Second: "-DCMAKE_PREFIX_PATH=" + pkg.GetVendorPath(home) + "/pkg"}
+		if err := r.recordIns(&meta, cmake, func() error {
+			started <- name
+			select {
+			case <-wait:
+				return nil
+			case <-time.After(5 * time.Second):
+				return fmt.Errorf("package %s: instructions of other package not run at the same time", name)
+			}
+		}); err != nil {
+			r.abort(name)
+			return err
+		}
+		cp := pkg.InsTriple{First: pkg.InsCp, Second: "include/" + name + ".h", Third: pkg.GetIncludePath(home)}
+		if err := r.recordIns(&meta, cp, func() error {
+			return os.WriteFile(filepath.Join(pkg.GetIncludePath(home), name+".h"), nil, 0644)
+		}); err != nil {
+			r.abort(name)
+			return err
+		}
+		return r.finish(&meta)
+	}
+
+	// each package waits until the instruction of the other package starts.
+	waitFoo, waitBar := make(chan string, 1), make(chan string, 1)
+	go func() {
+		for name := range started {
+			if name == "foo" {
+				waitBar <- name
+			} else {
+				waitFoo <- name
+			}
+		}
+	}()
+	errs := make(chan error, 2)
+	go func() { errs <- install("foo", waitFoo) }()
+	go func() { errs <- install("bar", waitBar) }()
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(started)
+
+	for _, name := range []string{"foo", "bar"} {
+		want := []string{"include/" + name + ".h"}
+		if m, err := pkg.LoadManifest(pkg.GetManifestPath(home, pkg.DefaultBuildType, name)); err != nil || !reflect.DeepEqual(m.Files, want) {
+			t.Errorf("unexpected manifest of %s: %v, %v", name, m, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package install
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/genshen/pkg"
+)
+
+const (
+	PlanFormatText = "text"
+	PlanFormatJson = "json"
+)
+
+// buildPlan is the output of `install -dry-run`: what will run for each build config.
+type buildPlan struct {
+	Configs []configPlan `json:"configs"`
+}
+
+type configPlan struct {
+	Name      string    `json:"name"`
+	BuildType string    `json:"build_type"`
+	Profile   string    `json:"profile,omitempty"`
+	Generator string    `json:"generator,omitempty"`
+	Packages  []pkgPlan `json:"packages"`
+}
+
+type pkgPlan struct {
+	Name         string   `json:"name"`
+	Version      string   `json:"version"`
+	Builder      string   `json:"builder"`            // "inner" (SelfBuild) or "outer" (Builder)
+	UpToDate     bool     `json:"up_to_date"`         // skipped by up-to-date checks
+	Instructions []string `json:"instructions"`       // instructions after template expansion
+	Commands     []string `json:"commands,omitempty"` // shell commands generated from the instructions
+}
+
+// insPlanner records the build plan of packages without running anything.
+// Commands are generated by the shell writer, with shell variables of project paths replaced by real paths.
+type insPlanner struct {
+	*InsShellWriter
+	buf      bytes.Buffer
+	metas    map[string]pkg.PackageMeta
+	envs     *pkg.PackageEnvs
+	packages map[string]pkgPlan
+}
+
+func newInsPlanner(pkgHome string, nJobs int32, cmakeConfigArg, cmakeBuildArg string, config buildConfig, metas map[string]pkg.PackageMeta) *insPlanner {
+	p := insPlanner{metas: metas, packages: make(map[string]pkgPlan)}
+	p.InsShellWriter, _ = NewInsShellWriter(pkgHome, bufio.NewWriter(&p.buf), nJobs, cmakeConfigArg, cmakeBuildArg, config)
+	return &p
+}
+
+func (p *insPlanner) Setup(ctx context.Context) error {
+	return nil
+}
+
+func (p *insPlanner) PkgPreInstall(ctx context.Context, meta *pkg.PackageMeta) (*pkg.PackageEnvs, error) {
+	envs, err := p.InsShellWriter.PkgPreInstall(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+	p.writer.Flush()
+	p.buf.Reset() // drop the package head written by shell writer.
+	p.envs = envs
+	return envs, nil
+}
+
+func (p *insPlanner) PkgPostInstall(ctx context.Context, meta *pkg.PackageMeta) error {
+	if err := p.writer.Flush(); err != nil {
+		return err
+	}
+	plan := pkgPlan{Name: meta.PackageName, Version: meta.Version, Builder: "inner"}
+	if len(meta.Builder) != 0 {
+		plan.Builder = "outer"
+	}
+	p.envs.Metas = p.metas
+	for _, ins := range buildInstructions(meta) {
+		if expandedIns, err := pkg.ExpandEnv(ins, p.envs); err != nil {
+			return err
+		} else {
+			plan.Instructions = append(plan.Instructions, p.realPath(expandedIns))
+		}
+	}
+	for _, line := range strings.Split(p.realPath(p.buf.String()), "\n") {
+		if line != "" {
+			plan.Commands = append(plan.Commands, line)
+		}
+	}
+	p.buf.Reset()
+	p.packages[meta.PackageName] = plan
+	return nil
+}
+
+// plan returns the plan of packages in lists (in building order),
+// packages not planned are skipped by up-to-date checks.
+func (p *insPlanner) plan(lists []string) configPlan {
+	c := configPlan{
+		Name:      p.config.name(),
+		BuildType: p.config.buildType,
+		Profile:   p.config.profileName,
+		Generator: p.config.generator,
+		Packages:  make([]pkgPlan, 0, len(lists)),
+	}
+	for _, name := range lists {
+		if plan, ok := p.packages[name]; ok {
+			c.Packages = append(c.Packages, plan)
+		} else {
+			meta := p.metas[name]
+			c.Packages = append(c.Packages, pkgPlan{Name: name, Version: meta.Version, UpToDate: true})
+		}
+	}
+	return c
+}
+
+// write the build plan in format text or json.
+func (b *buildPlan) write(w io.Writer, format string) error {
+	if format == PlanFormatJson {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(b)
+	}
+	for _, c := range b.Configs {
+		if _, err := fmt.Fprintf(w, "build config %s:\n", c.Name); err != nil {
+			return err
+		}
+		for i, p := range c.Packages {
+			if p.UpToDate {
+				fmt.Fprintf(w, "[%d/%d] %s@%s: up-to-date, skipped\n", i+1, len(c.Packages), p.Name, p.Version)
+				continue
+			}
+			fmt.Fprintf(w, "[%d/%d] %s@%s: %s build\n", i+1, len(c.Packages), p.Name, p.Version, p.Builder)
+			fmt.Fprintln(w, "  instructions:")
+			for _, ins := range p.Instructions {
+				fmt.Fprintf(w, "    %s\n", ins)
+			}
+			fmt.Fprintln(w, "  commands:")
+			for _, cmd := range p.Commands {
+				if _, err := fmt.Fprintf(w, "    %s\n", cmd); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package install
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/genshen/pkg"
+)
+
+func TestInsPlanner(t *testing.T) {
+	home := t.TempDir()
+	metas := map[string]pkg.PackageMeta{
+		"a": {PackageName: "a", Version: "v1", Builder: []string{"CMAKE -DA=ON"}},
+		"b": {PackageName: "b", Version: "v2", SelfBuild: []string{"RUN {{.CACHE}} make"}},
+	}
+	for _, meta := range metas {
+		if err := os.MkdirAll(meta.VendorSrcPath(home), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deps := map[string][]string{"b": {"a"}}
+	lists := []string{"a", "b"}
+	config := buildConfig{buildType: pkg.DefaultBuildType}
+
+	planConfig := func() configPlan {
+		planner := newInsPlanner(home, 2, "", "", config, metas)
+		stamps := newStampChecker(home, config, "", false, nil)
+		stamps.dryRun = true
+		if err := buildPkg(context.Background(), planner, lists, metas, buildOptions{jobs: 1, deps: deps, stamps: stamps}); err != nil {
+			t.Fatal(err)
+		}
+		return planner.plan(lists)
+	}
+
+	c := planConfig()
+	if len(c.Packages) != 2 || c.Packages[0].UpToDate || c.Packages[1].UpToDate {
+		t.Fatalf("expect all packages planned, but got %+v", c.Packages)
+	}
+	if c.Packages[0].Builder != "outer" || c.Packages[1].Builder != "inner" {
+		t.Errorf("unexpected builders: %+v", c.Packages)
+	}
+	metaA := metas["a"]
+	cmakeCmd := strings.Join(c.Packages[0].Commands, "\n")
+	if !strings.Contains(cmakeCmd, "cmake -S \""+metaA.VendorSrcPath(home)+"\"") || !strings.Contains(cmakeCmd, "-DA=ON") ||
+		!strings.Contains(cmakeCmd, "--parallel 2") || strings.Contains(cmakeCmd, "PROJECT_HOME") {
+		t.Errorf("unexpected cmake commands:\n%s", cmakeCmd)
+	}
+	if want := "RUN " + pkg.GetBuildCachePath(home, config.name(), "b") + " make"; c.Packages[1].Instructions[0] != want {
+		t.Errorf("expect expanded instruction `%s`, but got `%s`", want, c.Packages[1].Instructions[0])
+	}
+	// no stamps are written in dry-run mode.
+	if _, err := os.Stat(pkg.GetStampPath(home, config.name(), "a")); !os.IsNotExist(err) {
+		t.Fatalf("expect no stamp written in dry-run mode, but got %v", err)
+	}
+
+	// package a is up-to-date after it is built.
+	if err := buildPkg(context.Background(), &insRecorder{installs: newInstallRecorder(home, config.name())}, []string{"a"}, metas, buildOptions{jobs: 1, stamps: newStampChecker(home, config, "", false, nil)}); err != nil {
+		t.Fatal(err)
+	}
+	c = planConfig()
+	if !c.Packages[0].UpToDate || c.Packages[1].UpToDate {
+		t.Fatalf("expect only package a skipped, but got %+v", c.Packages)
+	}
+
+	var buf bytes.Buffer
+	plan := buildPlan{Configs: []configPlan{c}}
+	if err := plan.write(&buf, PlanFormatJson); err != nil {
+		t.Fatal(err)
+	}
+	var decoded buildPlan
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded.Configs[0].Packages) != 2 {
+		t.Fatalf("unexpected json plan: %s, %v", buf.String(), err)
+	}
+	buf.Reset()
+	if err := plan.write(&buf, PlanFormatText); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "[1/2] a@v1: up-to-date, skipped\n") || !strings.Contains(buf.String(), "[2/2] b@v2: inner build\n") {
+		t.Errorf("unexpected text plan:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,58 @@
+package install
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// prefixWriter writes output of a package line by line with a prefix (e.g. "[fmt] "),
+// thus the output of packages built concurrently are not mixed up in one line.
+type prefixWriter struct {
+	prefix []byte
+	out    io.Writer
+	mu     *sync.Mutex // shared by all writers writing to out.
+	buf    []byte      // incomplete line
+}
+
+func newPrefixWriter(out io.Writer, mu *sync.Mutex, prefix string) *prefixWriter {
+	return &prefixWriter{prefix: []byte(prefix), out: out, mu: mu}
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	i := bytes.LastIndexByte(w.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	lines := w.buf[:i+1]
+	if err := w.writeLines(lines); err != nil {
+		return 0, err
+	}
+	w.buf = append(w.buf[:0], w.buf[i+1:]...)
+	return len(p), nil
+}
+
+// Flush writes the last incomplete line.
+func (w *prefixWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.writeLines(append(w.buf, '\n'))
+	w.buf = w.buf[:0]
+	return err
+}
+
+func (w *prefixWriter) writeLines(lines []byte) error {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(lines, []byte("\n")) {
+		if len(line) != 0 {
+			out.Write(w.prefix)
+			out.Write(line)
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.out.Write(out.Bytes())
+	return err
+}
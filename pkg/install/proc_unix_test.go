@@ -0,0 +1,60 @@
+//go:build !windows
+
+package install
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/genshen/pkg"
+)
+
+func TestInvolveShell_Timeout(t *testing.T) {
+	home := t.TempDir()
+	in := NewInsExecutor(home, false, 1, "", "", buildConfig{buildType: pkg.DefaultBuildType})
+	meta := pkg.PackageMeta{PackageName: "foo", Version: "v1"}
+	pidFile := filepath.Join(home, "pid")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// the child process in background must be killed with the shell.
+	err := in.involveShell(ctx, &meta, pkg.InsRun, home, "sleep 30 & echo $! > "+pidFile+"; wait")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded error, but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expect command killed on timeout, but it took %s", elapsed)
+	}
+
+	content, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) || isZombie(pid) {
+			break
+		}
+		if i == 50 {
+			t.Fatalf("expect child process %d killed", pid)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// isZombie returns true if the process is killed but not reaped (only checked on linux by /proc).
+func isZombie(pid int) bool {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	return err == nil && strings.Contains(string(stat), ") Z ")
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package install
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup does nothing on windows, the command process is killed when the command is canceled.
+func setProcessGroup(cmd *exec.Cmd) {
+}
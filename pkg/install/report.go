@@ -0,0 +1,95 @@
+package install
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// status of a package after building.
+const (
+	pkgBuilt   = "built"   // built from source, or restored from the artifact cache
+	pkgSkipped = "skipped" // up-to-date, thus skipped
+	pkgFailed  = "failed"
+	pkgBlocked = "blocked" // not built, because its dependency failed or building is stopped
+)
+
+type pkgResult struct {
+	name     string
+	status   string
+	duration time.Duration
+	detail   string
+}
+
+// buildReport records the results of packages in a build, which is printed as a summary table at the end.
+type buildReport struct {
+	mu      sync.Mutex
+	results map[string]*pkgResult
+	order   []string // packages in building order
+}
+
+func newBuildReport(lists []string) *buildReport {
+	r := buildReport{results: make(map[string]*pkgResult), order: append([]string{}, lists...)}
+	for _, name := range lists {
+		r.results[name] = &pkgResult{name: name, status: pkgBlocked, detail: "not started"}
+	}
+	return &r
+}
+
+func (r *buildReport) set(name, status string, duration time.Duration, detail string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[name] = &pkgResult{name: name, status: status, duration: duration, detail: detail}
+}
+
+// failed returns names of failed packages.
+func (r *buildReport) failed() []string {
+	var names []string
+	for _, name := range r.order {
+		if r.results[name].status == pkgFailed {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// write the summary table of the build.
+func (r *buildReport) write(w io.Writer, config string) error {
+	counts := make(map[string]int)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "\nbuild summary of config %s:\n", config)
+	fmt.Fprintln(tw, "PACKAGE\tSTATUS\tDURATION\tDETAIL")
+	for _, name := range r.order {
+		result := r.results[name]
+		counts[result.status]++
+		duration := "-"
+		if result.status == pkgBuilt || result.status == pkgFailed {
+			duration = result.duration.Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, result.status, duration, result.detail)
+	}
+	fmt.Fprintf(tw, "total: %d packages, %d built, %d skipped, %d failed, %d blocked\n",
+		len(r.order), counts[pkgBuilt], counts[pkgSkipped], counts[pkgFailed], counts[pkgBlocked])
+	return tw.Flush()
+}
+
+// firstLine returns the first line of the error message, used as detail in the summary table.
+func firstLine(err error) string {
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return fmt.Sprintf("instruction %s failed: %s", cmdErr.Instruction, cmdErr.Err)
+	}
+	msg := err.Error()
+	for i, c := range msg {
+		if c == '\n' {
+			return msg[:i]
+		}
+	}
+	return msg
+}
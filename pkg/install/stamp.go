@@ -0,0 +1,218 @@
+package install
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/genshen/pkg"
+)
+
+// stampChecker decides whether a package needs to be built again.
+// A stamp is written to vendor/stamps/@config/@pkg.stamp after a package is built and installed successfully,
+// which is the hash of the package source tree, the expanded instructions, cmake arguments,
+// features, args and the stamps of its dependencies.
+// If the stamp of a package is unchanged, none of its dependencies is rebuilt and the files in its install manifest
+// all exist, the package is skipped.
+type stampChecker struct {
+	pkgHome   string
+	config    buildConfig
+	salt      string          // other inputs affecting all packages, e.g. cmake arguments from cli.
+	force     bool            // rebuild all packages
+	forcePkgs map[string]bool // packages to be rebuilt
+	dryRun    bool            // only check stamps, stamp files are not written or removed
+
+	mu      sync.Mutex
+	stamps  map[string]string // stamps of packages computed in this run
+	rebuilt map[string]bool   // packages rebuilt in this run
+}
+
+func newStampChecker(pkgHome string, config buildConfig, salt string, force bool, forcePkgs []string) *stampChecker {
+	s := stampChecker{
+		pkgHome:   pkgHome,
+		config:    config,
+		salt:      salt,
+		force:     force,
+		forcePkgs: make(map[string]bool),
+		stamps:    make(map[string]string),
+		rebuilt:   make(map[string]bool),
+	}
+	for _, name := range forcePkgs {
+		s.forcePkgs[name] = true
+	}
+	return &s
+}
+
+// check computes the stamp of a package, and returns true if the package is up-to-date.
+// deps: direct dependencies of the package.
+func (s *stampChecker) check(meta *pkg.PackageMeta, metas map[string]pkg.PackageMeta, deps []string) (string, bool, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "package: %s@%s#%s\n", meta.PackageName, meta.Version, meta.TargetName)
+	fmt.Fprintf(h, "salt: %s\n", s.salt)
+	fmt.Fprintf(h, "build type: %s\n", s.config.buildType)
+	fmt.Fprintf(h, "generator: %s\n", s.config.generator)
+	fmt.Fprintf(h, "profile: %s %s %s\n", s.config.profileName, s.config.profile.CMakeConfigArgs(), strings.Join(s.config.environ(), " "))
+	fmt.Fprintf(h, "features: %s\n", strings.Join(meta.Features, ","))
+	argKeys := make([]string, 0, len(meta.Args))
+	for k := range meta.Args {
+		argKeys = append(argKeys, k)
+	}
+	sort.Strings(argKeys)
+	for _, k := range argKeys {
+		fmt.Fprintf(h, "arg: %s=%s\n", k, meta.Args[k])
+	}
+
+	// instructions after expanding.
+	if instructions, err := expandInstructions(s.pkgHome, s.config, meta, metas); err != nil {
+		return "", false, err
+	} else {
+		for _, ins := range instructions {
+			fmt.Fprintf(h, "ins: %s\n", ins)
+		}
+	}
+
+	// source tree
+	if err := hashSourceTree(h, meta.VendorSrcPath(s.pkgHome)); err != nil {
+		return "", false, err
+	}
+
+	// stamps of dependencies
+	sortedDeps := append([]string{}, deps...)
+	sort.Strings(sortedDeps)
+	depRebuilt := false
+	for _, dep := range sortedDeps {
+		s.mu.Lock()
+		depStamp, ok := s.stamps[dep]
+		depRebuilt = depRebuilt || s.rebuilt[dep]
+		s.mu.Unlock()
+		if !ok { // the dependency is not built in this run, use the stamp on disk.
+			depStamp = s.readStamp(dep)
+		}
+		fmt.Fprintf(h, "dep: %s %s\n", dep, depStamp)
+	}
+
+	stamp := hex.EncodeToString(h.Sum(nil))
+	if s.forced(meta.PackageName) || depRebuilt {
+		return stamp, false, nil
+	}
+	if s.readStamp(meta.PackageName) != stamp {
+		return stamp, false, nil
+	}
+	// the installed files may be removed, e.g. by `rm -rf vendor/pkg`.
+	installed, err := s.installed(meta.PackageName)
+	return stamp, installed, err
+}
+
+// installed returns true if the install manifest of the package exists and all files in it exist.
+func (s *stampChecker) installed(name string) (bool, error) {
+	manifest, err := pkg.LoadManifest(pkg.GetManifestPath(s.pkgHome, s.config.name(), name))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	vendor := pkg.GetVendorPath(s.pkgHome)
+	for _, file := range manifest.Files {
+		if _, err := os.Lstat(filepath.Join(vendor, filepath.FromSlash(file))); err != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// expandInstructions returns the building instructions of a package after expanding templates.
+func expandInstructions(pkgHome string, config buildConfig, meta *pkg.PackageMeta, metas map[string]pkg.PackageMeta) ([]string, error) {
+	packageEnv := pkg.NewPackageEnvs(pkgHome, meta.PackageName, meta.VendorSrcPath(pkgHome))
+	config.setEnvs(packageEnv)
+	packageEnv.SetPackageMeta(meta)
+	packageEnv.Metas = metas
+	instructions := make([]string, 0)
+	for _, ins := range buildInstructions(meta) {
+		if expandedIns, err := pkg.ExpandEnv(ins, packageEnv); err != nil {
+			return nil, err
+		} else {
+			instructions = append(instructions, expandedIns)
+		}
+	}
+	return instructions, nil
+}
+
+// forced returns true if the package is forced to be rebuilt.
+func (s *stampChecker) forced(name string) bool {
+	return s.force || s.forcePkgs[name]
+}
+
+// done records the stamp of a package after it is built (rebuilt is true) or skipped (rebuilt is false).
+func (s *stampChecker) done(name, stamp string, rebuilt bool) error {
+	s.mu.Lock()
+	s.stamps[name] = stamp
+	s.rebuilt[name] = rebuilt
+	s.mu.Unlock()
+	if !rebuilt || s.dryRun {
+		return nil
+	}
+	stampPath := pkg.GetStampPath(s.pkgHome, s.config.name(), name)
+	if err := os.MkdirAll(filepath.Dir(stampPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(stampPath, []byte(stamp+"\n"), 0644)
+}
+
+// invalidate removes the stamp (and the saved artifact key) of a package, it is called before building the package,
+// thus a package failed to build (or interrupted) will be built again next time.
+func (s *stampChecker) invalidate(name string) error {
+	if s.dryRun {
+		return nil
+	}
+	for _, path := range []string{pkg.GetStampPath(s.pkgHome, s.config.name(), name), pkg.GetArtifactKeyPath(s.pkgHome, s.config.name(), name)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *stampChecker) readStamp(name string) string {
+	if content, err := os.ReadFile(pkg.GetStampPath(s.pkgHome, s.config.name(), name)); err != nil {
+		return ""
+	} else {
+		return strings.TrimSpace(string(content))
+	}
+}
+
+// hashSourceTree writes the path, mode, size and modification time of all files in directory src to h.
+// The `.git` directory is skipped.
+func hashSourceTree(h io.Writer, src string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil // e.g. the root package
+	}
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			fmt.Fprintf(h, "src: %s %s\n", filepath.ToSlash(rel), info.Mode())
+		} else {
+			fmt.Fprintf(h, "src: %s %s %d %d\n", filepath.ToSlash(rel), info.Mode(), info.Size(), info.ModTime().UnixNano())
+		}
+		return nil
+	})
+}
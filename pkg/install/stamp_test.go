@@ -0,0 +1,84 @@
+package install
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/genshen/pkg"
+)
+
+func TestStampChecker(t *testing.T) {
+	home := t.TempDir()
+	metas := map[string]pkg.PackageMeta{
+		"a": {PackageName: "a", Version: "v1", SelfBuild: []string{"RUN {{.CACHE}} make"}},
+		"b": {PackageName: "b", Version: "v1", SelfBuild: []string{"CMAKE"}},
+	}
+	for _, meta := range metas {
+		src := meta.VendorSrcPath(home)
+		if err := os.MkdirAll(src, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, "main.c"), []byte("int main(){}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deps := map[string][]string{"b": {"a"}}
+	lists := []string{"a", "b"}
+
+	build := func(s *stampChecker) []string {
+		r := &insRecorder{installs: newInstallRecorder(home, pkg.DefaultBuildType)}
+		if err := buildPkg(context.Background(), r, lists, metas, buildOptions{jobs: 1, deps: deps, stamps: s}); err != nil {
+			t.Fatal(err)
+		}
+		return r.built
+	}
+
+	if built := build(newStampChecker(home, buildConfig{buildType: pkg.DefaultBuildType}, "", false, nil)); len(built) != 2 {
+		t.Fatalf("expect all packages built at the first time, but got %v", built)
+	}
+	if built := build(newStampChecker(home, buildConfig{buildType: pkg.DefaultBuildType}, "", false, nil)); len(built) != 0 {
+		t.Fatalf("expect no packages built if nothing changed, but got %v", built)
+	}
+	// changing cli arguments rebuilds all packages.
+	if built := build(newStampChecker(home, buildConfig{buildType: pkg.DefaultBuildType}, "-DFOO=ON", false, nil)); len(built) != 2 {
+		t.Fatalf("expect all packages rebuilt if salt is changed, but got %v", built)
+	}
+	// forcing a package rebuilds its dependents.
+	if built := build(newStampChecker(home, buildConfig{buildType: pkg.DefaultBuildType}, "-DFOO=ON", false, []string{"a"})); len(built) != 2 {
+		t.Fatalf("expect package and its dependents rebuilt, but got %v", built)
+	}
+	// changing source of b only rebuilds b.
+	metaB := metas["b"]
+	if err := os.WriteFile(filepath.Join(metaB.VendorSrcPath(home), "new.c"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if built := build(newStampChecker(home, buildConfig{buildType: pkg.DefaultBuildType}, "-DFOO=ON", false, nil)); len(built) != 1 || built[0] != "b" {
+		t.Fatalf("expect only package b rebuilt, but got %v", built)
+	}
+	// removing installed files rebuilds the package.
+	prefixA := pkg.GetPackagePkgPathOf(home, pkg.DefaultBuildType, "a")
+	if err := os.MkdirAll(prefixA, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(prefixA, "liba.a"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if built := build(newStampChecker(home, buildConfig{buildType: pkg.DefaultBuildType}, "-DFOO=ON", true, nil)); len(built) != 2 {
+		t.Fatalf("expect all packages rebuilt if forced, but got %v", built)
+	}
+	if err := os.RemoveAll(prefixA); err != nil {
+		t.Fatal(err)
+	}
+	if built := build(newStampChecker(home, buildConfig{buildType: pkg.DefaultBuildType}, "-DFOO=ON", false, nil)); len(built) != 2 {
+		t.Fatalf("expect package a and its dependents rebuilt after its files are removed, but got %v", built)
+	}
+	// removing the install manifest rebuilds the package.
+	if err := os.Remove(pkg.GetManifestPath(home, pkg.DefaultBuildType, "b")); err != nil {
+		t.Fatal(err)
+	}
+	if built := build(newStampChecker(home, buildConfig{buildType: pkg.DefaultBuildType}, "-DFOO=ON", false, nil)); len(built) != 1 || built[0] != "b" {
+		t.Fatalf("expect only package b rebuilt after its manifest is removed, but got %v", built)
+	}
+}
@@ -0,0 +1,82 @@
+package lint
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/genshen/cmds"
+	"github.com/genshen/pkg"
+)
+
+var lintCommand = &cmds.Command{
+	Name:        "lint",
+	Summary:     "check file " + pkg.PkgFileName + " for errors",
+	Description: "check unknown keys, value types, instructions, template variables and features in file " + pkg.PkgFileName + ".",
+	CustomFlags: false,
+	HasOptions:  true,
+}
+
+func init() {
+	var pwd string
+	var err error
+	if pwd, err = os.Getwd(); err != nil {
+		pwd = "./"
+	}
+
+	var l lint
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	lintCommand.FlagSet = fs
+	lintCommand.FlagSet.StringVar(&l.home, "home", pwd, "path of home directory (where is "+pkg.PkgFileName+" file located)")
+	lintCommand.FlagSet.StringVar(&l.file, "f", "", "path of the file to be checked, default is "+pkg.PkgFileName+" in home directory")
+	lintCommand.FlagSet.BoolVar(&l.schema, "schema", false, "print JSON schema of "+pkg.PkgFileName+" (for editor integration), and skip checking")
+	lintCommand.FlagSet.Usage = lintCommand.Usage // use default usage provided by cmds.Command.
+	lintCommand.Runner = &l
+	cmds.AllCommands = append(cmds.AllCommands, lintCommand)
+}
+
+type lint struct {
+	home   string
+	file   string
+	schema bool
+}
+
+func (l *lint) PreRun() error {
+	if l.schema {
+		return nil
+	}
+	if l.file == "" {
+		if l.home == "" {
+			return errors.New("flag home is required")
+		}
+		l.file = filepath.Join(l.home, pkg.PkgFileName)
+	}
+	if fileInfo, err := os.Stat(l.file); err != nil {
+		return err
+	} else if fileInfo.IsDir() {
+		return fmt.Errorf("%s is not a file", l.file)
+	}
+	return nil
+}
+
+func (l *lint) Run() error {
+	if l.schema {
+		_, err := os.Stdout.Write(pkg.PkgYamlJsonSchema)
+		return err
+	}
+
+	content, err := os.ReadFile(l.file)
+	if err != nil {
+		return err
+	}
+	lintErrors := pkg.LintPkgYaml(content)
+	for _, e := range lintErrors {
+		fmt.Printf("%s:%d:%d: %s\n", l.file, e.Line, e.Column, e.Message)
+	}
+	if len(lintErrors) != 0 {
+		return fmt.Errorf("%d problem(s) found in %s", len(lintErrors), l.file)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package logs
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genshen/cmds"
+	"github.com/genshen/pkg"
+)
+
+var logsCommand = &cmds.Command{
+	Name:        "logs",
+	Summary:     "show building logs of a package",
+	Description: "show building logs of a package saved by the last `pkg install`, usage: pkg logs [options] <package>",
+	CustomFlags: false,
+	HasOptions:  true,
+}
+
+func init() {
+	var pwd string
+	var err error
+	if pwd, err = os.Getwd(); err != nil {
+		pwd = "./"
+	}
+
+	var l logs
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	logsCommand.FlagSet = fs
+	logsCommand.FlagSet.StringVar(&l.home, "home", pwd, "path of home directory (where is "+pkg.PkgFileName+" file located)")
+	logsCommand.FlagSet.BoolVar(&l.list, "list", false, "only list the log files")
+	logsCommand.FlagSet.IntVar(&l.tail, "tail", 0, "only show the last N lines of each log file, 0 for all lines")
+	logsCommand.FlagSet.Usage = logsCommand.Usage // use default usage provided by cmds.Command.
+	logsCommand.Runner = &l
+	cmds.AllCommands = append(cmds.AllCommands, logsCommand)
+}
+
+type logs struct {
+	home        string
+	list        bool
+	tail        int
+	packageName string
+}
+
+func (l *logs) PreRun() error {
+	if l.home == "" {
+		return errors.New("flag home is required")
+	}
+	fs := logsCommand.FlagSet
+	if fs.NArg() == 0 {
+		return errors.New("package is not specified")
+	}
+	l.packageName = fs.Arg(0)
+	// flags after the package name.
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+func (l *logs) Run() error {
+	logDir := pkg.GetPackageLogPath(l.home, l.packageName)
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no building logs found for package %s", l.packageName)
+		}
+		return err
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".log") {
+			files = append(files, filepath.Join(logDir, entry.Name()))
+		}
+	}
+	// log files are named by config and step, steps are compared as numbers, thus step 100 is after step 99.
+	sort.Slice(files, func(i, j int) bool {
+		ci, si := logStep(filepath.Base(files[i]))
+		cj, sj := logStep(filepath.Base(files[j]))
+		if ci != cj {
+			return ci < cj
+		}
+		if si != sj {
+			return si < sj
+		}
+		return files[i] < files[j]
+	})
+
+	for _, file := range files {
+		if l.list {
+			fmt.Println(file)
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		lines := strings.SplitAfter(string(content), "\n")
+		if len(lines) != 0 && lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if l.tail > 0 && len(lines) > l.tail {
+			lines = lines[len(lines)-l.tail:]
+		}
+		fmt.Printf("==> %s <==\n%s\n", file, strings.Join(lines, ""))
+	}
+	return nil
+}
+
+// logStep returns the build config and step of a log file named as <config>-<step>-<verb>.log.
+// The name itself and step 0 are returned if the name is not in this format.
+func logStep(name string) (string, int) {
+	rest := strings.TrimSuffix(name, ".log")
+	if i := strings.LastIndex(rest, "-"); i > 0 {
+		rest = rest[:i]
+	}
+	if i := strings.LastIndex(rest, "-"); i > 0 {
+		if step, err := strconv.Atoi(rest[i+1:]); err == nil {
+			return rest[:i], step
+		}
+	}
+	return name, 0
+}
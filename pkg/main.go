@@ -6,12 +6,21 @@ import (
 
 	"github.com/genshen/cmds"
 	_ "github.com/genshen/pkg/pkg/clean"
+	_ "github.com/genshen/pkg/pkg/edit"
+	_ "github.com/genshen/pkg/pkg/env"
 	_ "github.com/genshen/pkg/pkg/export"
 	_ "github.com/genshen/pkg/pkg/fetch"
+	_ "github.com/genshen/pkg/pkg/graph"
 	_ "github.com/genshen/pkg/pkg/import"
 	_ "github.com/genshen/pkg/pkg/init"
 	_ "github.com/genshen/pkg/pkg/install"
+	_ "github.com/genshen/pkg/pkg/lint"
 	_ "github.com/genshen/pkg/pkg/list"
+	_ "github.com/genshen/pkg/pkg/logs"
+	_ "github.com/genshen/pkg/pkg/migrate"
+	_ "github.com/genshen/pkg/pkg/outdated"
+	_ "github.com/genshen/pkg/pkg/run"
+	_ "github.com/genshen/pkg/pkg/uninstall"
 	_ "github.com/genshen/pkg/pkg/version"
 	log "github.com/sirupsen/logrus"
 )
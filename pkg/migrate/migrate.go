@@ -0,0 +1,82 @@
+package migrate
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/genshen/cmds"
+	"github.com/genshen/pkg"
+	"github.com/rogpeppe/go-internal/diff"
+	log "github.com/sirupsen/logrus"
+)
+
+var migrateCommand = &cmds.Command{
+	Name:        "migrate",
+	Summary:     "rewrite " + pkg.PkgFileName + " in old format version to the current format version",
+	Description: "rewrite " + pkg.PkgFileName + " in old format version to the current format version, comments are kept.",
+	CustomFlags: false,
+	HasOptions:  true,
+}
+
+func init() {
+	var pwd string
+	var err error
+	if pwd, err = os.Getwd(); err != nil {
+		pwd = "./"
+	}
+
+	var m migrate
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	migrateCommand.FlagSet = fs
+	migrateCommand.FlagSet.StringVar(&m.home, "home", pwd, "path of home directory (where is "+pkg.PkgFileName+" file located)")
+	migrateCommand.FlagSet.BoolVar(&m.dryRun, "dry-run", false, "print the changes as diff, and do not rewrite the file")
+	migrateCommand.FlagSet.Usage = migrateCommand.Usage // use default usage provided by cmds.Command.
+	migrateCommand.Runner = &m
+	cmds.AllCommands = append(cmds.AllCommands, migrateCommand)
+}
+
+type migrate struct {
+	home   string
+	dryRun bool
+}
+
+func (m *migrate) PreRun() error {
+	if m.home == "" {
+		return errors.New("flag home is required")
+	}
+	// check pkg.yaml file existence.
+	if fileInfo, err := os.Stat(filepath.Join(m.home, pkg.PkgFileName)); err != nil {
+		return err
+	} else if fileInfo.IsDir() {
+		return fmt.Errorf("%s is not a file", pkg.PkgFileName)
+	}
+	return nil
+}
+
+func (m *migrate) Run() error {
+	pkgFilePath := filepath.Join(m.home, pkg.PkgFileName)
+	content, err := os.ReadFile(pkgFilePath)
+	if err != nil {
+		return err
+	}
+	newContent, changed, err := pkg.MigratePkgYaml(content)
+	if err != nil {
+		return err
+	} else if !changed {
+		log.WithFields(log.Fields{"file": pkgFilePath}).Infof("already in the current format version %d.", pkg.FORMAT_VERSION)
+		return nil
+	}
+
+	if m.dryRun {
+		_, err := os.Stdout.Write(diff.Diff(pkgFilePath, content, pkgFilePath+" (migrated)", newContent))
+		return err
+	}
+	if err := os.WriteFile(pkgFilePath, newContent, 0644); err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"file": pkgFilePath}).Infof("migrated to format version %d.", pkg.FORMAT_VERSION)
+	return nil
+}
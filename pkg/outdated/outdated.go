@@ -0,0 +1,224 @@
+package outdated
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/genshen/cmds"
+	"github.com/genshen/pkg"
+	"github.com/genshen/pkg/conf"
+	"github.com/genshen/pkg/pkg/fetch"
+	log "github.com/sirupsen/logrus"
+)
+
+var outdatedCommand = &cmds.Command{
+	Name:        "outdated",
+	Summary:     "list dependency packages with newer upstream versions",
+	Description: "list git dependency packages with newer tags and archive packages with newer releases.",
+	CustomFlags: false,
+	HasOptions:  true,
+}
+
+func init() {
+	var pwd string
+	var err error
+	if pwd, err = os.Getwd(); err != nil {
+		pwd = "./"
+	}
+
+	var o outdated
+	fs := flag.NewFlagSet("outdated", flag.ExitOnError)
+	outdatedCommand.FlagSet = fs
+	outdatedCommand.FlagSet.StringVar(&o.home, "home", pwd, "path of home directory (where is "+pkg.PkgFileName+" file located)")
+	outdatedCommand.FlagSet.BoolVar(&o.check, "check", false, "exit with non-zero status if any package is outdated (for CI)")
+	outdatedCommand.FlagSet.Usage = outdatedCommand.Usage // use default usage provided by cmds.Command.
+	outdatedCommand.Runner = &o
+	cmds.AllCommands = append(cmds.AllCommands, outdatedCommand)
+}
+
+type outdated struct {
+	home          string
+	check         bool
+	auth          map[string]conf.Auth
+	globalReplace map[string]string
+}
+
+// a dependency package to be checked.
+type depPackage struct {
+	name    string
+	current string // current version
+	// for git packages
+	gitUrl string
+	// for archive packages
+	versionUrl   string
+	versionRegex string
+}
+
+// the checking result of a package.
+type outdatedResult struct {
+	name       string
+	current    string
+	compatible string // latest compatible version
+	latest     string // latest version
+	err        error
+}
+
+func (o *outdated) PreRun() error {
+	if o.home == "" {
+		return errors.New("flag home is required")
+	}
+	pkgFilePath := filepath.Join(o.home, pkg.PkgFileName)
+	// check pkg.yaml file existence.
+	if fileInfo, err := os.Stat(pkgFilePath); err != nil {
+		return err
+	} else if fileInfo.IsDir() {
+		return fmt.Errorf("%s is not a file", pkg.PkgFileName)
+	}
+
+	// parse git auth and git replace.
+	if config, err := conf.ParseConfig(o.home); err != nil {
+		return err
+	} else {
+		o.auth = config.Auth
+		o.globalReplace = config.GitReplace
+	}
+	return nil
+}
+
+func (o *outdated) Run() error {
+	deps := make([]depPackage, 0)
+	visited := make(map[string]bool)
+	if err := o.collectDeps(filepath.Join(o.home, pkg.PkgFileName), visited, &deps); err != nil {
+		return err
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].name < deps[j].name
+	})
+
+	results := make([]outdatedResult, 0, len(deps))
+	for _, dep := range deps {
+		log.WithFields(log.Fields{"pkg": dep.name}).Info("checking upstream versions.")
+		results = append(results, checkPackage(dep, o.auth))
+	}
+
+	// print table
+	numOutdated, numFailed := 0, 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tCURRENT\tCOMPATIBLE\tLATEST\t")
+	for _, r := range results {
+		if r.err != nil {
+			log.WithFields(log.Fields{"pkg": r.name}).Warning("failed to check upstream versions: ", r.err)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", r.name, r.current, "?", "?")
+			numFailed++
+			continue
+		}
+		if fetch.IsNewerVersion(r.current, r.compatible) || fetch.IsNewerVersion(r.current, r.latest) {
+			numOutdated++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", r.name, r.current, orDash(r.compatible), orDash(r.latest))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if o.check && numOutdated != 0 {
+		return fmt.Errorf("%d package(s) are outdated", numOutdated)
+	}
+	if o.check && numFailed != 0 {
+		return fmt.Errorf("failed to check upstream versions of %d package(s)", numFailed)
+	}
+	return nil
+}
+
+// collectDeps collects git and archive dependencies of the package described by pkgYamlPath,
+// and dependencies of the git packages that already fetched into vendor directory.
+func (o *outdated) collectDeps(pkgYamlPath string, visited map[string]bool, deps *[]depPackage) error {
+	pkgYaml, err := pkg.ParsePkgYaml(pkgYamlPath)
+	if err != nil {
+		return err
+	}
+	// migrate package based on pkg.yaml v1 to v2
+	if err := pkgYaml.Packages.MigrateToV2(&pkgYaml.Deps); err != nil {
+		return err
+	}
+
+	for key, gitPkg := range pkgYaml.Deps.GitPackages {
+		meta := pkg.PackageMeta{Version: gitPkg.Version}
+		if err := meta.SetPackageName(key); err != nil {
+			return err
+		}
+		if _, ok := visited[meta.PackageName+"@"+meta.Version]; ok {
+			continue
+		}
+		visited[meta.PackageName+"@"+meta.Version] = true
+		*deps = append(*deps, depPackage{
+			name:    meta.PackageName,
+			current: meta.Version,
+			gitUrl:  fetch.GitRemoteUrl(gitPkg.Path, meta.PackageName, pkgYaml.GitReplace, o.globalReplace),
+		})
+
+		// check dependencies of this package, if it has been fetched.
+		subPkgYamlPath := filepath.Join(meta.VendorSrcPath(o.home), pkg.PkgFileName)
+		if _, err := os.Stat(subPkgYamlPath); err == nil {
+			if err := o.collectDeps(subPkgYamlPath, visited, deps); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, archivePkg := range pkgYaml.Deps.ArchivePackages {
+		if archivePkg.VersionUrl == "" || archivePkg.VersionRegex == "" {
+			continue // no way to discover new releases.
+		}
+		if _, ok := visited[name]; ok {
+			continue
+		}
+		visited[name] = true
+		reg, err := regexp.Compile(archivePkg.VersionRegex)
+		if err != nil {
+			return fmt.Errorf("bad version_regex of package %s: %w", name, err)
+		}
+		current := "latest"
+		if versions := fetch.MatchVersions(reg, archivePkg.Path); len(versions) != 0 {
+			current = versions[0]
+		}
+		*deps = append(*deps, depPackage{
+			name:         name,
+			current:      current,
+			versionUrl:   archivePkg.VersionUrl,
+			versionRegex: archivePkg.VersionRegex,
+		})
+	}
+	return nil
+}
+
+// checkPackage queries the upstream versions of a package.
+func checkPackage(dep depPackage, auth map[string]conf.Auth) outdatedResult {
+	result := outdatedResult{name: dep.name, current: dep.current}
+	var versions []string
+	var err error
+	if dep.gitUrl != "" {
+		versions, err = fetch.ListGitTags(auth, dep.gitUrl)
+	} else {
+		versions, err = fetch.ListArchiveVersions(dep.versionUrl, dep.versionRegex)
+	}
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.compatible, result.latest = fetch.LatestVersions(dep.current, versions)
+	return result
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
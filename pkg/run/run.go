@@ -0,0 +1,111 @@
+package run
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/genshen/cmds"
+	"github.com/genshen/pkg"
+)
+
+var runCommand = &cmds.Command{
+	Name:        "run",
+	Summary:     "run a command with installed packages in environment",
+	Description: "run a command with PATH, LD_LIBRARY_PATH, PKG_CONFIG_PATH, CMAKE_PREFIX_PATH, CPATH and LIBRARY_PATH covering all installed packages, usage: pkg run [options] -- <command> [args...]",
+	CustomFlags: false,
+	HasOptions:  true,
+}
+
+func init() {
+	var pwd string
+	var err error
+	if pwd, err = os.Getwd(); err != nil {
+		pwd = "./"
+	}
+
+	var r run
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	runCommand.FlagSet = fs
+	runCommand.FlagSet.StringVar(&r.home, "home", pwd, "path of home directory (where is "+pkg.PkgFileName+" file located)")
+	runCommand.FlagSet.StringVar(&r.config, "config", pkg.DefaultBuildType, "build config of the installed packages, e.g. Release, Debug, or <profile>-<build type>.")
+	runCommand.FlagSet.Usage = runCommand.Usage // use default usage provided by cmds.Command.
+	runCommand.Runner = &r
+	cmds.AllCommands = append(cmds.AllCommands, runCommand)
+}
+
+type run struct {
+	home   string
+	config string
+	args   []string // the command and its arguments
+}
+
+func (r *run) PreRun() error {
+	if r.home == "" {
+		return errors.New("flag home is required")
+	}
+	r.args = runCommand.FlagSet.Args()
+	if len(r.args) == 0 {
+		return errors.New("command is not specified, usage: pkg run [options] -- <command> [args...]")
+	}
+	return nil
+}
+
+func (r *run) Run() error {
+	vars, err := pkg.LoadInstalledEnv(r.home, r.config)
+	if err != nil {
+		return err
+	}
+	environ := pkg.Environ(os.Environ(), vars)
+	// the command is searched in PATH with the installed packages, e.g. tools in vendor/pkg/@pkg/bin.
+	path, err := pkg.LookPath(r.args[0], environ)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(path, r.args[1:]...)
+	cmd.Args[0] = r.args[0]
+	cmd.Env = environ
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// SIGINT from terminal is also sent to the command, and the command decides whether to exit.
+	// SIGTERM is forwarded to the command.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				if sig == syscall.SIGTERM {
+					cmd.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// exit with the same code as the command, or 1 if it is killed by signal.
+			code := exitErr.ExitCode()
+			if code < 0 {
+				code = 1
+			}
+			os.Exit(code)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package uninstall
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/genshen/cmds"
+	"github.com/genshen/pkg"
+	log "github.com/sirupsen/logrus"
+)
+
+var uninstallCommand = &cmds.Command{
+	Name:        "uninstall",
+	Summary:     "remove files installed by a package",
+	Description: "remove files installed by a package, which are recorded in " + pkg.VendorName + "/" + pkg.VendorManifests + " by `pkg install`, usage: pkg uninstall [options] <package>",
+	CustomFlags: false,
+	HasOptions:  true,
+}
+
+func init() {
+	var pwd string
+	var err error
+	if pwd, err = os.Getwd(); err != nil {
+		pwd = "./"
+	}
+
+	var u uninstall
+	fs := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	uninstallCommand.FlagSet = fs
+	uninstallCommand.FlagSet.StringVar(&u.home, "home", pwd, "path of home directory (where is "+pkg.PkgFileName+" file located)")
+	uninstallCommand.FlagSet.StringVar(&u.config, "config", "", "only uninstall the package of a build config (e.g. Debug, or <profile>-<build type>), default is all build configs.")
+	uninstallCommand.FlagSet.Usage = uninstallCommand.Usage // use default usage provided by cmds.Command.
+	uninstallCommand.Runner = &u
+	cmds.AllCommands = append(cmds.AllCommands, uninstallCommand)
+}
+
+type uninstall struct {
+	home        string
+	config      string
+	packageName string
+}
+
+func (u *uninstall) PreRun() error {
+	if u.home == "" {
+		return errors.New("flag home is required")
+	}
+	fs := uninstallCommand.FlagSet
+	if fs.NArg() == 0 {
+		return errors.New("package is not specified")
+	}
+	u.packageName = fs.Arg(0)
+	// flags after the package name.
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+func (u *uninstall) Run() error {
+	manifests, err := pkg.LoadManifests(u.home)
+	if err != nil {
+		return err
+	}
+	// files installed by other packages (in any build config) are kept.
+	others := make(map[string]string)
+	for _, m := range manifests {
+		if m.Package != u.packageName {
+			for _, file := range m.Files {
+				others[file] = m.Package
+			}
+		}
+	}
+
+	found := false
+	for _, m := range manifests {
+		if m.Package != u.packageName || (u.config != "" && pkg.PkgPrefixDirName(m.Config) != pkg.PkgPrefixDirName(u.config)) {
+			continue
+		}
+		found = true
+		removed, err := m.RemoveFiles(u.home, func(file string) bool {
+			if other, ok := others[file]; ok {
+				log.WithFields(log.Fields{"file": file, "other": other}).Warning("file is also installed by another package, it is kept.")
+				return true
+			}
+			return false
+		})
+		if err != nil {
+			return err
+		}
+		// remove the manifest and stamp, thus the package will be built again in next installation.
+		for _, path := range []string{pkg.GetManifestPath(u.home, m.Config, m.Package), pkg.GetStampPath(u.home, m.Config, m.Package)} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		log.WithFields(log.Fields{"pkg": m.Package, "config": m.Config, "files": removed}).Info("package uninstalled.")
+	}
+	if !found {
+		return fmt.Errorf("no install manifest found for package %s, make sure it is installed by `pkg install`", u.packageName)
+	}
+	return nil
+}
@@ -2,26 +2,30 @@ package pkg
 
 import (
 	"fmt"
+	"os"
 	"runtime"
+
+	"gopkg.in/yaml.v3"
 )
 
 // YamlPkg is for pkg yaml file parsing
 type YamlPkg struct {
-	FormatVersion int                     `yaml:"version"`
-	MinPkgVersion string                  `yaml:"min_pkg_version"`
-	Args          map[string]string       `yaml:"args"`
-	GitReplace    map[string]string       `yaml:"git-replace"`
-	PkgName       string                  `yaml:"pkg"`
-	Packages      V1Packages              `yaml:"packages"` // for pkg file version 1
-	Deps          YamlDependencies        `yaml:"dependencies"`
-	Features      map[string]YamlFeatures `yaml:"features"`
-	Build         map[string][]string     `yaml:"build"`
-	CMakeLib      string                  `yaml:"cmake_lib"`
+	FormatVersion int                         `yaml:"version"`
+	MinPkgVersion string                      `yaml:"min_pkg_version"`
+	Args          map[string]string           `yaml:"args"`
+	GitReplace    map[string]string           `yaml:"git-replace"`
+	PkgName       string                      `yaml:"pkg"`
+	Packages      V1Packages                  `yaml:"packages"` // for pkg file version 1
+	Deps          YamlDependencies            `yaml:"dependencies"`
+	Features      map[string]YamlFeatures     `yaml:"features"`
+	Build         map[string]YamlInstructions `yaml:"build"`
+	CMakeLib      string                      `yaml:"cmake_lib"`
 }
 
 type YamlFeatures struct {
-	Needs []string `yaml:"needs"` // other features this feature depending on.
-	Deps  []string `yaml:"deps"`  // the dependency package for this feature
+	Needs []string       `yaml:"needs"` // other features this feature depending on.
+	Deps  []string       `yaml:"deps"`  // the dependency package for this feature
+	When  *YamlCondition `yaml:"when"`  // the feature can only be activated on the matched platforms.
 }
 
 type YamlDependencies struct {
@@ -32,7 +36,8 @@ type YamlDependencies struct {
 
 type YamlPackage struct {
 	V1Package `yaml:",inline"`
-	Optional  bool `yaml:"optional"` // if true: this package is optional
+	Optional  bool           `yaml:"optional"` // if true: this package is optional
+	When      *YamlCondition `yaml:"when"`     // the package is only used on the matched platforms.
 }
 
 type YamlGitPackage struct {
@@ -50,8 +55,10 @@ type YamlFilesPackage struct {
 const DefaultArchiveFormatType = "zip"
 
 type YamlArchivePackage struct {
-	YamlPackage `yaml:",inline"`
-	Type        string `yaml:"type"` // archive type, support: zip, tar.gz, tar.bz2, tar. Default: zip.
+	YamlPackage  `yaml:",inline"`
+	Type         string `yaml:"type"`          // archive type, support: zip, tar.gz, tar.bz2, tar. Default: zip.
+	VersionUrl   string `yaml:"version_url"`   // optional page listing releases, used to discover new versions.
+	VersionRegex string `yaml:"version_regex"` // regular expression to match versions in the archive path and the version_url page.
 }
 
 // for pkg file version 1.
@@ -61,11 +68,11 @@ type V1Packages struct {
 }
 
 type V1Package struct {
-	Path             string   `yaml:"path"`
-	Override         bool     `yaml:"override"` // override package self build.
-	Build            []string `yaml:"build"`
-	CMakeLib         string   `yaml:"cmake_lib"`
-	CMakeLibOverride bool     `yaml:"cmake_lib_override"`
+	Path             string           `yaml:"path"`
+	Override         bool             `yaml:"override"` // override package self build.
+	Build            YamlInstructions `yaml:"build"`
+	CMakeLib         string           `yaml:"cmake_lib"`
+	CMakeLibOverride bool             `yaml:"cmake_lib_override"`
 }
 
 type V1GitPackage struct {
@@ -80,13 +87,31 @@ type V1FilesPackage struct {
 	Files     map[string]string `yaml:"files"`
 }
 
+// ParsePkgYaml reads and parses a pkg.yaml file.
+func ParsePkgYaml(filename string) (*YamlPkg, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pkgYaml := YamlPkg{}
+	if err := yaml.Unmarshal(content, &pkgYaml); err != nil {
+		return nil, err
+	}
+	return &pkgYaml, nil
+}
+
 // find builder by os. If builder[os] is not found, return a fallback builder.
 func (yamlPkg *YamlPkg) FindBuilder() []string {
-	if _build, ok := yamlPkg.Build[runtime.GOOS]; ok {
-		return _build[:] // builder can be empty if specified
+	return yamlPkg.FindBuilderFor(runtime.GOOS)
+}
+
+// FindBuilderFor finds builder for the target os goos. If builder[goos] is not found, return a fallback builder.
+func (yamlPkg *YamlPkg) FindBuilderFor(goos string) []string {
+	if _build, ok := yamlPkg.Build[goos]; ok {
+		return _build.Strings() // builder can be empty if specified
 	}
 	if _build, ok := yamlPkg.Build["fallback"]; ok {
-		return _build[:] // builder can be empty if specified
+		return _build.Strings() // builder can be empty if specified
 	}
 	return nil
 }
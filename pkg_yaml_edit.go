@@ -0,0 +1,243 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sections of `dependencies` in pkg.yaml
+const (
+	DepsSectionGit     = "packages"
+	DepsSectionFiles   = "files"
+	DepsSectionArchive = "archives"
+)
+
+// PkgYamlDoc is a pkg.yaml file parsed as yaml nodes.
+// Editing the document keeps comments and the ordering of keys.
+type PkgYamlDoc struct {
+	doc yaml.Node
+}
+
+// LoadPkgYamlDoc reads a pkg.yaml file as yaml nodes.
+func LoadPkgYamlDoc(filename string) (*PkgYamlDoc, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePkgYamlDoc(content)
+}
+
+func ParsePkgYamlDoc(content []byte) (*PkgYamlDoc, error) {
+	var d PkgYamlDoc
+	if err := yaml.Unmarshal(content, &d.doc); err != nil {
+		return nil, err
+	}
+	if d.doc.Kind == 0 { // empty file
+		d.doc.Kind = yaml.DocumentNode
+		d.doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	if d.doc.Kind != yaml.DocumentNode || len(d.doc.Content) != 1 || d.doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("the top level of pkg.yaml must be a mapping")
+	}
+	return &d, nil
+}
+
+// Root returns the top level mapping node of the document.
+func (d *PkgYamlDoc) Root() *yaml.Node {
+	return d.doc.Content[0]
+}
+
+// Bytes encodes the document into yaml content.
+func (d *PkgYamlDoc) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&d.doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Save writes the document to file.
+func (d *PkgYamlDoc) Save(filename string) error {
+	if content, err := d.Bytes(); err != nil {
+		return err
+	} else {
+		return os.WriteFile(filename, content, 0644)
+	}
+}
+
+// Decode decodes the document into YamlPkg.
+func (d *PkgYamlDoc) Decode() (*YamlPkg, error) {
+	var pkgYaml YamlPkg
+	if err := d.doc.Decode(&pkgYaml); err != nil {
+		return nil, err
+	}
+	return &pkgYaml, nil
+}
+
+// MappingValue finds the key with name `key` in a mapping node.
+// It returns the index of the key node in the content of mapping node and the value node.
+// If the key is not found, -1 and nil are returned.
+func MappingValue(mapping *yaml.Node, key string) (int, *yaml.Node) {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return -1, nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i, mapping.Content[i+1]
+		}
+	}
+	return -1, nil
+}
+
+// SetMappingValue sets value of key in a mapping node.
+// If the key exists, its value is replaced (the comments of the key are kept), otherwise the key is appended.
+func SetMappingValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	if i, _ := MappingValue(mapping, key); i >= 0 {
+		mapping.Content[i+1] = value
+		return
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// RemoveMappingKey removes a key and its value from a mapping node.
+// It returns false if the key is not found.
+func RemoveMappingKey(mapping *yaml.Node, key string) bool {
+	i, _ := MappingValue(mapping, key)
+	if i < 0 {
+		return false
+	}
+	mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+	return true
+}
+
+// ensureMapping returns the mapping value of key in node mapping, it creates an empty mapping if it does not exist.
+func ensureMapping(mapping *yaml.Node, key string) (*yaml.Node, error) {
+	_, value := MappingValue(mapping, key)
+	if value == nil || (value.Kind == yaml.ScalarNode && value.Tag == "!!null") {
+		value = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		SetMappingValue(mapping, key, value)
+	}
+	if value.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("`%s` in %s must be a mapping", key, PkgFileName)
+	}
+	return value, nil
+}
+
+// dependency package name of a key in `dependencies`, the key can be in format of name@version@target.
+func depKeyPackageName(key string) string {
+	return strings.SplitN(key, "@", 2)[0]
+}
+
+// FindDependency finds a dependency package by package name in `dependencies` section.
+// It returns the section (packages, files or archives) and the key of the dependency.
+func (d *PkgYamlDoc) FindDependency(packageName string) (section string, key string, found bool) {
+	_, deps := MappingValue(d.Root(), "dependencies")
+	for _, sec := range []string{DepsSectionGit, DepsSectionFiles, DepsSectionArchive} {
+		_, secNode := MappingValue(deps, sec)
+		if secNode == nil || secNode.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(secNode.Content); i += 2 {
+			if depKeyPackageName(secNode.Content[i].Value) == packageName {
+				return sec, secNode.Content[i].Value, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// NewFlowMapping creates a mapping node in flow style from key-value pairs,
+// e.g. NewFlowMapping("version", "1.0.0", "optional", true) for `{version: 1.0.0, optional: true}`.
+func NewFlowMapping(pairs ...interface{}) (*yaml.Node, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("key-value pairs must be in even number")
+	}
+	mapping := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Style: yaml.FlowStyle}
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("key %v must be a string", pairs[i])
+		}
+		var value yaml.Node
+		if err := value.Encode(pairs[i+1]); err != nil {
+			return nil, err
+		}
+		value.Style |= yaml.FlowStyle
+		SetMappingValue(mapping, key, &value)
+	}
+	return mapping, nil
+}
+
+// AddDependency adds a dependency package into section (packages, files or archives) of `dependencies`.
+func (d *PkgYamlDoc) AddDependency(section, key string, value *yaml.Node) error {
+	if sec, _, found := d.FindDependency(depKeyPackageName(key)); found {
+		return fmt.Errorf("package %s already exists in dependencies.%s", depKeyPackageName(key), sec)
+	}
+	deps, err := ensureMapping(d.Root(), "dependencies")
+	if err != nil {
+		return err
+	}
+	secNode, err := ensureMapping(deps, section)
+	if err != nil {
+		return err
+	}
+	SetMappingValue(secNode, key, value)
+	return nil
+}
+
+// RemoveDependency removes a dependency package by package name.
+// It returns false if the package is not found.
+func (d *PkgYamlDoc) RemoveDependency(packageName string) bool {
+	section, key, found := d.FindDependency(packageName)
+	if !found {
+		return false
+	}
+	_, deps := MappingValue(d.Root(), "dependencies")
+	_, secNode := MappingValue(deps, section)
+	return RemoveMappingKey(secNode, key)
+}
+
+// SetDependencyVersion changes version of a git dependency package.
+// If the version is specified in the key (name@version@target), the key is rewritten,
+// otherwise, the `version` field is set.
+func (d *PkgYamlDoc) SetDependencyVersion(packageName, version string) error {
+	section, key, found := d.FindDependency(packageName)
+	if !found {
+		return fmt.Errorf("package %s is not found in dependencies", packageName)
+	}
+	if section != DepsSectionGit {
+		return fmt.Errorf("package %s is not a git package, its version can not be changed", packageName)
+	}
+	_, deps := MappingValue(d.Root(), "dependencies")
+	_, secNode := MappingValue(deps, section)
+	i, value := MappingValue(secNode, key)
+
+	if keySplit := strings.SplitN(key, "@", 3); len(keySplit) >= 2 {
+		keySplit[1] = version
+		secNode.Content[i].Value = strings.Join(keySplit, "@")
+	}
+	// version in the value has higher priority than version in key.
+	_, versionNode := MappingValue(value, "version")
+	if versionNode != nil {
+		versionNode.Value = version
+		versionNode.Tag = "!!str"
+		versionNode.Style = 0
+	} else if !strings.Contains(key, "@") {
+		if value.Kind != yaml.MappingNode {
+			// e.g. `github.com/foo/bar: ` with null value.
+			*value = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Style: yaml.FlowStyle}
+		}
+		SetMappingValue(value, "version", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: version})
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+const pkgYamlEditExample = `version: 3
+# dependencies of the project
+dependencies:
+  packages:
+    # google test
+    github.com/google/googletest: {version: release-1.8.0, target: GTest}
+    github.com/fmtlib/fmt@4.1.0@fmt:
+      build:
+        - CP a b
+`
+
+func TestPkgYamlDoc_EditDependencies(t *testing.T) {
+	doc, err := ParsePkgYamlDoc([]byte(pkgYamlEditExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := NewFlowMapping("version", "1.10", "target", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.AddDependency(DepsSectionGit, "github.com/foo/bar", value); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.AddDependency(DepsSectionGit, "github.com/fmtlib/fmt", value); err == nil {
+		t.Error("adding an existed package must return an error")
+	}
+	if err := doc.SetDependencyVersion("github.com/google/googletest", "release-1.12.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.SetDependencyVersion("github.com/fmtlib/fmt", "10.2.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	pkgYaml, err := doc.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkgYaml.Deps.GitPackages["github.com/foo/bar"].Version != "1.10" {
+		t.Errorf("unexpected version of added package: %v", pkgYaml.Deps.GitPackages["github.com/foo/bar"])
+	}
+	if pkgYaml.Deps.GitPackages["github.com/google/googletest"].Version != "release-1.12.0" {
+		t.Error("version of googletest is not updated")
+	}
+	if _, ok := pkgYaml.Deps.GitPackages["github.com/fmtlib/fmt@10.2.1@fmt"]; !ok {
+		t.Error("version in key of fmt is not updated")
+	}
+
+	if !doc.RemoveDependency("github.com/google/googletest") || doc.RemoveDependency("github.com/google/googletest") {
+		t.Error("unexpected result of removing package")
+	}
+	content, err := doc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "# dependencies of the project") {
+		t.Errorf("comments are not kept:\n%s", content)
+	}
+}
@@ -0,0 +1,168 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FormatVersion returns the format version of the document, 0 is returned if it is not specified.
+func (d *PkgYamlDoc) FormatVersion() (int, error) {
+	_, versionNode := MappingValue(d.Root(), "version")
+	if versionNode == nil {
+		return 0, nil
+	}
+	var version int
+	if err := versionNode.Decode(&version); err != nil {
+		return 0, fmt.Errorf("bad format version at line %d: %w", versionNode.Line, err)
+	}
+	return version, nil
+}
+
+// Migrate rewrites the document from an old format version to FORMAT_VERSION.
+// It returns false if the document is already in the current format version.
+// Packages in the `packages` section (format version 1) are moved into the `dependencies` section.
+// Comments of the moved packages are kept.
+func (d *PkgYamlDoc) Migrate() (bool, error) {
+	version, err := d.FormatVersion()
+	if err != nil {
+		return false, err
+	}
+	if version > FORMAT_VERSION {
+		return false, fmt.Errorf("format version %d is newer than the format version %d supported by pkg %s", version, FORMAT_VERSION, VERSION)
+	}
+	_, v1Packages := MappingValue(d.Root(), "packages")
+	if version == FORMAT_VERSION && v1Packages == nil {
+		return false, nil
+	}
+
+	if v1Packages != nil {
+		if err := d.migrateV1Packages(v1Packages); err != nil {
+			return false, err
+		}
+	}
+
+	versionNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(FORMAT_VERSION)}
+	if i, _ := MappingValue(d.Root(), "version"); i >= 0 {
+		d.Root().Content[i+1] = versionNode
+	} else {
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+		d.Root().Content = append([]*yaml.Node{keyNode, versionNode}, d.Root().Content...)
+	}
+	return true, nil
+}
+
+// migrateV1Packages moves git and files packages of format version 1 into `dependencies`,
+// the same as V1Packages.MigrateToV2 does in memory.
+func (d *PkgYamlDoc) migrateV1Packages(v1Packages *yaml.Node) error {
+	root := d.Root()
+	// if there is no `dependencies` section, replace key `packages` by `dependencies` to keep the position.
+	if i, _ := MappingValue(root, "dependencies"); i < 0 {
+		pkgKeyIndex, _ := MappingValue(root, "packages")
+		root.Content[pkgKeyIndex].Value = "dependencies"
+		root.Content[pkgKeyIndex+1] = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	} else {
+		RemoveMappingKey(root, "packages")
+	}
+	if v1Packages.Kind == yaml.ScalarNode && v1Packages.Tag == "!!null" {
+		return nil
+	}
+	if v1Packages.Kind != yaml.MappingNode {
+		return fmt.Errorf("`packages` in %s must be a mapping", PkgFileName)
+	}
+
+	deps, err := ensureMapping(root, "dependencies")
+	if err != nil {
+		return err
+	}
+	if _, gitPackages := MappingValue(v1Packages, "git"); gitPackages != nil && gitPackages.Kind == yaml.MappingNode {
+		secNode, err := ensureMapping(deps, DepsSectionGit)
+		if err != nil {
+			return err
+		}
+		for i := 0; i+1 < len(gitPackages.Content); i += 2 {
+			key, value := gitPackages.Content[i], gitPackages.Content[i+1]
+			if _, found := MappingValue(secNode, key.Value); found != nil {
+				continue // the package in v2 has higher priority.
+			}
+			if err := migrateV1GitPackage(key.Value, value); err != nil {
+				return err
+			}
+			secNode.Content = append(secNode.Content, key, value)
+		}
+	}
+	if _, filesPackages := MappingValue(v1Packages, "files"); filesPackages != nil && filesPackages.Kind == yaml.MappingNode {
+		secNode, err := ensureMapping(deps, DepsSectionFiles)
+		if err != nil {
+			return err
+		}
+		for i := 0; i+1 < len(filesPackages.Content); i += 2 {
+			key, value := filesPackages.Content[i], filesPackages.Content[i+1]
+			if _, found := MappingValue(secNode, key.Value); found != nil {
+				continue
+			}
+			secNode.Content = append(secNode.Content, key, value)
+		}
+	}
+	return nil
+}
+
+// migrateV1GitPackage replaces tag/branch/hash of a git package in format version 1 by version and target.
+func migrateV1GitPackage(name string, value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("package %s version(tag/branch/hash) is not specified", name)
+	}
+	version := ""
+	for _, key := range []string{"tag", "branch", "hash"} {
+		if _, node := MappingValue(value, key); node != nil && version == "" {
+			version = node.Value
+		}
+	}
+	if version == "" {
+		return fmt.Errorf("package %s version(tag/branch/hash) is not specified", name)
+	}
+	for _, key := range []string{"tag", "branch", "hash"} {
+		RemoveMappingKey(value, key)
+	}
+	value.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: version},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "target"},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: name},
+	}, value.Content...)
+	return nil
+}
+
+// MigratePkgYaml migrates content of a pkg.yaml file to FORMAT_VERSION, see PkgYamlDoc.Migrate.
+// If only the format version is changed, the version line is replaced in place,
+// thus the formatting of the file (e.g. blank lines) is kept.
+func MigratePkgYaml(content []byte) ([]byte, bool, error) {
+	doc, err := ParsePkgYamlDoc(content)
+	if err != nil {
+		return nil, false, err
+	}
+	_, v1Packages := MappingValue(doc.Root(), "packages")
+	_, versionNode := MappingValue(doc.Root(), "version")
+	if changed, err := doc.Migrate(); err != nil || !changed {
+		return content, false, err
+	}
+	// make sure the migrated file is still a valid pkg.yaml file.
+	if _, err := doc.Decode(); err != nil {
+		return nil, false, err
+	}
+
+	if v1Packages == nil && versionNode != nil && versionNode.Kind == yaml.ScalarNode {
+		lines := bytes.SplitAfter(content, []byte("\n"))
+		line := lines[versionNode.Line-1]
+		start := versionNode.Column - 1
+		if start+len(versionNode.Value) <= len(line) && string(line[start:start+len(versionNode.Value)]) == versionNode.Value {
+			newLine := append([]byte(string(line[:start])+strconv.Itoa(FORMAT_VERSION)), line[start+len(versionNode.Value):]...)
+			lines[versionNode.Line-1] = newLine
+			return bytes.Join(lines, nil), true, nil
+		}
+	}
+	newContent, err := doc.Bytes()
+	return newContent, true, err
+}
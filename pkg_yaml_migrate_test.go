@@ -0,0 +1,60 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigratePkgYaml(t *testing.T) {
+	content := `version: 1
+# packages in format version 1
+packages:
+  git:
+    # the fmt library
+    github.com/fmtlib/fmt:
+      tag: 4.1.0
+      build: ["CMAKE {{.CACHE}}"]
+  files:
+    github.com/foo/bar:
+      files: {a.txt: https://example.com/a.txt}
+`
+	newContent, changed, err := MigratePkgYaml([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("expect the file to be changed")
+	}
+	if errs := LintPkgYaml(newContent); len(errs) != 0 {
+		t.Fatalf("migrated file has errors: %v\n%s", errs, newContent)
+	}
+	for _, s := range []string{"version: 3", "# the fmt library", "version: 4.1.0", "target: github.com/fmtlib/fmt", "dependencies:"} {
+		if !strings.Contains(string(newContent), s) {
+			t.Errorf("expect %q in migrated file:\n%s", s, newContent)
+		}
+	}
+
+	doc, err := ParsePkgYamlDoc(newContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgYaml, err := doc.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgYaml.Deps.GitPackages) != 1 || len(pkgYaml.Deps.FilesPackages) != 1 {
+		t.Errorf("unexpected dependencies after migration: %+v", pkgYaml.Deps)
+	}
+
+	// only the version line is changed for format version 2.
+	content = "version: 2 # format\n\nargs:\n"
+	if newContent, _, err = MigratePkgYaml([]byte(content)); err != nil {
+		t.Fatal(err)
+	} else if string(newContent) != "version: 3 # format\n\nargs:\n" {
+		t.Errorf("unexpected migrated content: %q", newContent)
+	}
+
+	if _, _, err := MigratePkgYaml([]byte("version: 99\n")); err == nil {
+		t.Error("expect error for newer format version")
+	}
+}
@@ -0,0 +1,8 @@
+package pkg
+
+import _ "embed"
+
+// PkgYamlJsonSchema is the JSON schema of pkg.yaml file, which can be used for editor integration.
+//
+//go:embed schema/pkg.schema.json
+var PkgYamlJsonSchema []byte
@@ -1,22 +1,29 @@
 package pkg
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
 const (
-	VendorName            = "vendor"
-	VendorCache           = "cache"
-	VendorSrc             = "src"
-	VendorPkg             = "pkg"
-	VendorScripts         = "scripts"
-	VendorInclude         = "include"
-	VendorLib             = "lib"
-	VendorLib64           = "lib64"
-	VendorUserHome        = ".pkg"
-	VendorUserHomeSrc     = "registry/default-pkg/src"
-	VendorUserHomeSrcTemp = "registry/default-pkg/src/temp"
+	VendorName              = "vendor"
+	VendorCache             = "cache"
+	VendorSrc               = "src"
+	VendorPkg               = "pkg"
+	VendorScripts           = "scripts"
+	VendorInclude           = "include"
+	VendorLib               = "lib"
+	VendorLib64             = "lib64"
+	VendorStamps            = "stamps"
+	VendorLogs              = "logs"
+	VendorManifests         = "manifests"
+	VendorUserHome          = ".pkg"
+	VendorUserHomeSrc       = "registry/default-pkg/src"
+	VendorUserHomeSrcTemp   = "registry/default-pkg/src/temp"
+	VendorUserHomeArtifacts = "artifacts"
 )
 
 const (
@@ -25,11 +32,17 @@ const (
 	PkgSumFileName      = VendorName + "/" + PurgePkgSumFileName
 	VendorSrcDir        = VendorName + "/" + "src"
 	BuildShellName      = "pkg.build.sh"
+	BuildMakefileName   = "pkg.build.mk"
 	CMakeDep            = "pkg.dep.cmake"
-	DepGraph            = "pkg.graph"
+	DepGraph            = "pkg.graph.json"
+	LegacyDepGraph      = "pkg.graph" // graph file in text format written by old versions of pkg
 	CMakeVendorPath     = "${VENDOR_PATH}"
+	CMakePkgPrefixDir   = "${PKG_PREFIX_DIR}" // name of install prefix directory in vendor, selected by CMAKE_BUILD_TYPE
 )
 
+// DefaultBuildType is the default cmake build type (build config) of packages.
+const DefaultBuildType = "Release"
+
 const RootPKG = "root"
 
 func GetVendorPath(base string) string {
@@ -40,6 +53,10 @@ func GetPkgBuildPath(base string) string {
 	return filepath.Join(base, VendorName, BuildShellName)
 }
 
+func GetPkgBuildMakefilePath(base string) string {
+	return filepath.Join(base, VendorName, BuildMakefileName)
+}
+
 func GetDepGraphPath(base string) string {
 	return filepath.Join(base, VendorName, DepGraph)
 }
@@ -74,22 +91,65 @@ func MakeGlobalPackageSrcDlTempPath() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	srcDlTempPaths.Lock()
+	srcDlTempPaths.paths = append(srcDlTempPaths.paths, srcTempPath)
+	srcDlTempPaths.Unlock()
 	return srcTempPath, nil
 }
 
+// temp directories created by MakeGlobalPackageSrcDlTempPath, which are removed on cancellation.
+var srcDlTempPaths struct {
+	sync.Mutex
+	paths []string
+}
+
+// RemoveSrcDlTempPaths removes the temp directories created by MakeGlobalPackageSrcDlTempPath.
+// The directories already moved to the source path do not exist, and they are ignored.
+func RemoveSrcDlTempPaths() error {
+	srcDlTempPaths.Lock()
+	defer srcDlTempPaths.Unlock()
+	var errs []error
+	for _, path := range srcDlTempPaths.paths {
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	srcDlTempPaths.paths = nil
+	return errors.Join(errs...)
+}
+
 // return @base/vendor/pkg/@packageName
 func GetPackagePkgPath(base string, packageName string) (path string) {
 	return filepath.Join(base, VendorName, VendorPkg, packageName)
 }
 
+// PkgPrefixDirName returns name of the install prefix directory in vendor for a build config:
+// "pkg" for the default build type (Release), and "pkg-@config" (in lower case) for others.
+func PkgPrefixDirName(config string) string {
+	if config == "" || config == DefaultBuildType {
+		return VendorPkg
+	}
+	return VendorPkg + "-" + strings.ToLower(config)
+}
+
+// return @base/vendor/@prefix/@packageName, prefix is decided by build config (see PkgPrefixDirName).
+func GetPackagePkgPathOf(base, config, packageName string) (path string) {
+	return filepath.Join(base, VendorName, PkgPrefixDirName(config), packageName)
+}
+
+// return @base/vendor/${PKG_PREFIX_DIR}/@packageName, used in cmake script.
+func GetCMakePackagePkgPath(base, packageName string) (path string) {
+	return filepath.Join(base, VendorName, CMakePkgPrefixDir, packageName)
+}
+
 // return @base/vendor/deps/@packageName
 func GetPackageDepsPath(base string, packageName string) (path string) {
 	return filepath.Join(base, VendorName, "deps", packageName)
 }
 
-// return ${VENDOR_PATH}/pkg/@packageName
+// return ${VENDOR_PATH}/${PKG_PREFIX_DIR}/@packageName
 func GetCMakeVendorPkgPath(packageName string) (path string) {
-	return filepath.Join(CMakeVendorPath, VendorPkg, packageName)
+	return filepath.Join(CMakeVendorPath, CMakePkgPrefixDir, packageName)
 }
 
 // return @base/vendor/pkg/@packageName/include
@@ -97,6 +157,11 @@ func GetPkgIncludePath(base string, packageName string) (path string) {
 	return filepath.Join(base, VendorName, VendorPkg, packageName, VendorInclude)
 }
 
+// return $HOME/.pkg/artifacts, the cache of installed packages shared by projects.
+func GetArtifactCachePath() (string, error) {
+	return GetPkgUserHomeFile(VendorUserHomeArtifacts)
+}
+
 // return $HOME/.pkg/registry/default-pkg/src
 func GetHomeSrcPath() (string, error) {
 	if path, err := GetPkgUserHomeFile(VendorUserHomeSrc); err != nil {
@@ -124,11 +189,41 @@ func GetIncludePath(base string) (path string) {
 	return filepath.Join(base, VendorName, VendorInclude)
 }
 
-// return @base/vendor/cache
+// return @base/vendor/stamps/@config/@packageName.stamp
+func GetStampPath(base, config, packageName string) string {
+	return filepath.Join(base, VendorName, VendorStamps, config, packageName+".stamp")
+}
+
+// return @base/vendor/stamps/@config/@packageName.key, the artifact cache key of the installed package.
+func GetArtifactKeyPath(base, config, packageName string) string {
+	return filepath.Join(base, VendorName, VendorStamps, config, packageName+".key")
+}
+
+// return @base/vendor/manifests/@config/@packageName.json
+func GetManifestPath(base, config, packageName string) string {
+	return filepath.Join(base, VendorName, VendorManifests, config, packageName+".json")
+}
+
+// return @base/vendor/scripts/@config/@packageName, scripts of building steps generated for Makefile.
+func GetPackageScriptPath(base, config, packageName string) string {
+	return filepath.Join(base, VendorName, VendorScripts, config, packageName)
+}
+
+// return @base/vendor/logs/@packageName
+func GetPackageLogPath(base, packageName string) string {
+	return filepath.Join(base, VendorName, VendorLogs, packageName)
+}
+
+// return @base/vendor/cache/@packageName
 func GetCachePath(base, packageName string) (path string) {
 	return filepath.Join(base, VendorName, VendorCache, packageName)
 }
 
+// return @base/vendor/cache/@packageName/@config, the cmake build tree of a build config.
+func GetBuildCachePath(base, config, packageName string) (path string) {
+	return filepath.Join(base, VendorName, VendorCache, packageName, config)
+}
+
 //
 //func CheckVendorPath(base string) error {
 //	if err := CheckDirectoryLists(